@@ -0,0 +1,137 @@
+// Command exporter serves the dps and the protocol health of tuya devices as Prometheus metrics.
+//
+// The devices are read from a json file:
+//
+//	[
+//		{"id": "15580880bcaac262j6eg", "key": "A2In><,:-{Hy:[%K7", "ip": "192.168.178.30"},
+//		{"id": "bf4b2e7a8d0c5a1f3e9x2k", "key": "0123456789abcdef", "version": "3.4"}
+//	]
+//
+// Devices without an ip are resolved from the discovery broadcasts, devices without a version detect it
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/Binozo/GoTuya/pkg/metrics"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// deviceConfig describes a single device of the config file
+type deviceConfig struct {
+	ID      string `json:"id"`
+	Key     string `json:"key"`
+	IP      string `json:"ip"`
+	Version string `json:"version"`
+}
+
+func main() {
+	configPath := flag.String("config", "devices.json", "json file listing the devices")
+	listen := flag.String("listen", "localhost:9464", "address the metrics are served on")
+	refreshInterval := flag.Duration("refresh", 30*time.Second, "interval the status of the connected devices is fetched in. 0 relies on the pushed updates only")
+	verbose := flag.Bool("verbose", false, "log every frame")
+	flag.Parse()
+
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	configs, err := readConfig(*configPath)
+	if err != nil {
+		logger.Error("couldn't read the config", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	collector := metrics.CreateCollector()
+	manager := tuya.CreateManager(0)
+	var devices []*tuya.Device
+	for _, config := range configs {
+		device := createDevice(config)
+		device.Logger = logger
+		collector.Add(device)
+		if err = manager.Add(device); err != nil {
+			logger.Error("couldn't add the device", slog.String("device", config.ID), slog.Any("error", err))
+			os.Exit(1)
+		}
+		devices = append(devices, device)
+	}
+	if *refreshInterval > 0 {
+		go refresh(ctx, devices, *refreshInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	logger.Info("serving metrics", slog.String("address", "http://"+*listen+"/metrics"))
+	if err = server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Error("couldn't serve the metrics", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	manager.Close(closeCtx)
+}
+
+// readConfig reads the devices from the json file
+func readConfig(path string) ([]deviceConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []deviceConfig
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// createDevice from its config
+func createDevice(config deviceConfig) *tuya.Device {
+	version := tuya.Version(config.Version)
+	if version == "" {
+		version = tuya.Version_Auto
+	}
+	if config.IP == "" {
+		return tuya.CreateDeviceByID(config.ID, config.Key, version)
+	}
+	return tuya.CreateDevice(config.IP, config.ID, config.Key, version)
+}
+
+// refresh fetches the status of the connected devices, so dps which aren't pushed stay up to date
+func refresh(ctx context.Context, devices []*tuya.Device, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, device := range devices {
+			if !device.IsConnected() {
+				// The Manager is reconnecting it
+				continue
+			}
+			fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			device.FetchStatusContext(fetchCtx)
+			cancel()
+		}
+	}
+}
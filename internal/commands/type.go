@@ -1,8 +1,43 @@
 package commands
 
+import "strconv"
+
 type Type int
 
+const SESS_KEY_NEG_START Type = 3  // for 3.4 protocol
+const SESS_KEY_NEG_RESP Type = 4   // for 3.4 protocol
+const SESS_KEY_NEG_FINISH Type = 5 // for 3.4 protocol
 const CONTROL Type = 7
+const STATUS Type = 8
+const HEART_BEAT Type = 9
 const DP_QUERY Type = 10
+const CONTROL_NEW Type = 13  // for 3.4 protocol
 const DP_QUERY_NEW Type = 16 // for 3.4 protocol
 const DP_REFRESH Type = 18
+
+// String returns the name of the command
+func (t Type) String() string {
+	switch t {
+	case SESS_KEY_NEG_START:
+		return "SESS_KEY_NEG_START"
+	case SESS_KEY_NEG_RESP:
+		return "SESS_KEY_NEG_RESP"
+	case SESS_KEY_NEG_FINISH:
+		return "SESS_KEY_NEG_FINISH"
+	case CONTROL:
+		return "CONTROL"
+	case STATUS:
+		return "STATUS"
+	case HEART_BEAT:
+		return "HEART_BEAT"
+	case DP_QUERY:
+		return "DP_QUERY"
+	case CONTROL_NEW:
+		return "CONTROL_NEW"
+	case DP_QUERY_NEW:
+		return "DP_QUERY_NEW"
+	case DP_REFRESH:
+		return "DP_REFRESH"
+	}
+	return "UNKNOWN_" + strconv.Itoa(int(t))
+}
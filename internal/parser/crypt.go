@@ -3,10 +3,19 @@ package parser
 import (
 	"bytes"
 	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
 )
 
 const blockSize = 16
 
+// ErrDecryptionFailed is returned if the payload couldn't be decrypted, usually because of a wrong key
+var ErrDecryptionFailed = errors.New("the payload couldn't be decrypted")
+
+// ErrInvalidPadding is returned if the decrypted payload doesn't end with a valid PKCS#7 padding
+var ErrInvalidPadding = fmt.Errorf("%w: invalid padding", ErrDecryptionFailed)
+
 func EncryptAESWithECB(data, key []byte) ([]byte, error) {
 	// Make a copy of the input data to avoid modifying the original slice
 	dataCopy := make([]byte, len(data))
@@ -34,35 +43,67 @@ func EncryptAESWithECB(data, key []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
+// DecryptAESWithECB decrypts the data and removes the PKCS#7 padding added by EncryptAESWithECB.
+// Data which isn't aligned to the block size or doesn't end with a valid padding has been encrypted with another key
 func DecryptAESWithECB(encrypted, key []byte) ([]byte, error) {
+	if len(encrypted) == 0 || len(encrypted)%blockSize != 0 {
+		return nil, fmt.Errorf("%w: the length %d isn't a multiple of the block size", ErrDecryptionFailed, len(encrypted))
+	}
+
 	// Create a new AES cipher with the provided key
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if the encrypted data length is a multiple of the block size
-	if len(encrypted)%blockSize != 0 {
-		// Calculate the padding length needed to align the last block
-		paddingLen := blockSize - (len(encrypted) % blockSize)
-
-		// Append padding to the encrypted data to align the last block
-		padded := append(encrypted, bytes.Repeat([]byte{byte(0)}, paddingLen)...)
+	decrypted := make([]byte, len(encrypted))
+	for i := 0; i < len(encrypted); i += blockSize {
+		block.Decrypt(decrypted[i:i+blockSize], encrypted[i:i+blockSize])
+	}
+	return unpad(decrypted)
+}
 
-		// Perform decryption of the padded data
-		decrypted := make([]byte, len(padded))
-		for i := 0; i < len(padded); i += blockSize {
-			block.Decrypt(decrypted[i:i+blockSize], padded[i:i+blockSize])
+// unpad strictly removes the PKCS#7 padding
+func unpad(data []byte) ([]byte, error) {
+	paddingLen := int(data[len(data)-1])
+	if paddingLen == 0 || paddingLen > blockSize || paddingLen > len(data) {
+		return nil, ErrInvalidPadding
+	}
+	for _, padding := range data[len(data)-paddingLen:] {
+		if int(padding) != paddingLen {
+			return nil, ErrInvalidPadding
 		}
-
-		return decrypted, nil
 	}
+	return data[:len(data)-paddingLen], nil
+}
 
-	// Perform decryption of the encrypted data directly
-	decrypted := make([]byte, len(encrypted))
-	for i := 0; i < len(encrypted); i += blockSize {
-		block.Decrypt(decrypted[i:i+blockSize], encrypted[i:i+blockSize])
+// EncryptAESWithGCM encrypts the data and returns the ciphertext followed by the authentication tag.
+// additionalData is authenticated but not encrypted
+func EncryptAESWithGCM(data, key, iv, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key, iv)
+	if err != nil {
+		return nil, err
 	}
+	return aead.Seal(nil, iv, data, additionalData), nil
+}
 
+// DecryptAESWithGCM decrypts the ciphertext followed by the authentication tag
+func DecryptAESWithGCM(encrypted, key, iv, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := aead.Open(nil, iv, encrypted, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
 	return decrypted, nil
 }
+
+func newGCM(key, iv []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, len(iv))
+}
@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// maxFrameSize protects against allocating huge buffers because of garbage which looks like a header
+const maxFrameSize = 64 * 1024
+
+// FrameReader reads complete frames from a stream like a tcp connection.
+// It waits for frames split across several reads, splits frames arriving within the same read
+// and skips any garbage until the next valid frame
+type FrameReader struct {
+	reader *bufio.Reader
+}
+
+// NewFrameReader creates a FrameReader reading from r
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{
+		// The buffer has to hold a complete frame to check its suffix before consuming it
+		reader: bufio.NewReaderSize(r, maxFrameSize),
+	}
+}
+
+// ReadFrame blocks until the next complete frame has been read.
+// Bytes of an incomplete frame stay buffered if reading fails, e.g. because of a deadline
+func (f *FrameReader) ReadFrame() ([]byte, error) {
+	for {
+		prefix, err := f.reader.Peek(4)
+		if err != nil {
+			return nil, err
+		}
+
+		var headerSize int
+		switch binary.BigEndian.Uint32(prefix) {
+		case Prefix55AA:
+			headerSize = HeaderSize
+		case Prefix6699:
+			headerSize = HeaderSize6699
+		default:
+			// Resync on the next byte
+			if err = f.skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		header, err := f.reader.Peek(headerSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		frameSize, ok := FrameSize(header)
+		// Garbage which only looks like a header may be followed by valid frames, which must not be waited for
+		if !ok || f.reader.Buffered() < frameSize && f.bufferedFrameFollows() {
+			if err = f.skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		frame, err := f.reader.Peek(frameSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		// The stream ended before the frame was complete or the frame doesn't end with the matching suffix
+		if err == io.EOF || !hasSuffix(frame) {
+			if err = f.skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		frame = bytes.Clone(frame)
+		if _, err = f.reader.Discard(frameSize); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+}
+
+// skip the first buffered byte to resync on the next one
+func (f *FrameReader) skip() error {
+	_, err := f.reader.Discard(1)
+	return err
+}
+
+// bufferedFrameFollows returns if a complete frame is buffered behind the first byte
+func (f *FrameReader) bufferedFrameFollows() bool {
+	buffered, _ := f.reader.Peek(f.reader.Buffered())
+	for offset := 1; offset+4 <= len(buffered); offset++ {
+		prefix := binary.BigEndian.Uint32(buffered[offset:])
+		if prefix != Prefix55AA && prefix != Prefix6699 {
+			continue
+		}
+		frameSize, ok := FrameSize(buffered[offset:])
+		if ok && offset+frameSize <= len(buffered) && hasSuffix(buffered[offset:offset+frameSize]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSuffix returns if the complete frame ends with the suffix matching its prefix
+func hasSuffix(frame []byte) bool {
+	if len(frame) < 8 {
+		return false
+	}
+	suffix := binary.BigEndian.Uint32(frame[len(frame)-suffixSize:])
+	switch binary.BigEndian.Uint32(frame[0:4]) {
+	case Prefix55AA:
+		return suffix == Suffix55AA
+	case Prefix6699:
+		return suffix == Suffix6699
+	}
+	return false
+}
+
+// FrameSize returns the total size of the frame described by the given header.
+// The header has to be complete for the frame type (HeaderSize or HeaderSize6699)
+func FrameSize(header []byte) (int, bool) {
+	if len(header) < 4 {
+		return 0, false
+	}
+
+	var frameSize int
+	switch binary.BigEndian.Uint32(header[0:4]) {
+	case Prefix55AA:
+		if len(header) < HeaderSize {
+			return 0, false
+		}
+		// The length contains everything after the header including the suffix
+		frameSize = HeaderSize + int(binary.BigEndian.Uint32(header[12:16]))
+		if frameSize < HeaderSize+crcSize+suffixSize {
+			return 0, false
+		}
+	case Prefix6699:
+		if len(header) < HeaderSize6699 {
+			return 0, false
+		}
+		// The length doesn't contain the suffix
+		frameSize = HeaderSize6699 + int(binary.BigEndian.Uint32(header[14:18])) + suffixSize
+		if frameSize < HeaderSize6699+IvSize+tagSize+suffixSize {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if frameSize > maxFrameSize {
+		return 0, false
+	}
+	return frameSize, true
+}
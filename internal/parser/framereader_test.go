@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/Binozo/GoTuya/internal/commands"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// encodeFrame encodes a frame of the version with the sequence number as payload
+func encodeFrame(t *testing.T, version string, sequenceNr uint32) []byte {
+	t.Helper()
+	frame, err := EncodeMessage(Message{
+		SequenceNr: sequenceNr,
+		Command:    commands.STATUS,
+		Payload:    []byte(`{"dps":{"1":true}}`),
+	}, version, testKey)
+	if err != nil {
+		t.Fatalf("encoding the frame failed: %v", err)
+	}
+	return frame
+}
+
+// fakeHeader returns a 55AA header announcing the length without any frame following it
+func fakeHeader(length uint32) []byte {
+	header := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint32(header[0:], Prefix55AA)
+	binary.BigEndian.PutUint32(header[12:], length)
+	return header
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// readAll reads frames until the reader fails and returns the frames and the error
+func readAll(reader *FrameReader) ([][]byte, error) {
+	var frames [][]byte
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	frame33 := encodeFrame(t, "3.3", 1)
+	frame34 := encodeFrame(t, "3.4", 2)
+	frame35 := encodeFrame(t, "3.5", 3)
+	wrongSuffix := bytes.Clone(frame33)
+	wrongSuffix[len(wrongSuffix)-1] ^= 0xFF
+
+	tests := []struct {
+		name   string
+		stream []byte
+		// oneByte delivers the stream byte by byte like a slow connection
+		oneByte bool
+		want    [][]byte
+	}{
+		{"single frame", frame33, false, [][]byte{frame33}},
+		{"partial reads", concat(frame33, frame35), true, [][]byte{frame33, frame35}},
+		{"coalesced frames", concat(frame33, frame34, frame35), false, [][]byte{frame33, frame34, frame35}},
+		{"leading garbage", concat([]byte{0x01, 0x00, 0x00, 0x55}, frame33), false, [][]byte{frame33}},
+		{"garbage between frames", concat(frame33, []byte("garbage"), frame35), true, [][]byte{frame33, frame35}},
+		{"fake header with plausible length", concat(fakeHeader(1000), frame33, frame35), false, [][]byte{frame33, frame35}},
+		{"fake header with plausible length read byte by byte", concat(fakeHeader(1000), frame33, frame35), true, [][]byte{frame33, frame35}},
+		{"fake header with oversized length", concat(fakeHeader(maxFrameSize), frame34), false, [][]byte{frame34}},
+		{"wrong suffix", concat(wrongSuffix, frame34), false, [][]byte{frame34}},
+		{"truncated frame", concat(frame33, frame35[:len(frame35)-1]), false, [][]byte{frame33}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(test.stream)
+			if test.oneByte {
+				r = iotest.OneByteReader(r)
+			}
+
+			frames, err := readAll(NewFrameReader(r))
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("expected io.EOF at the end of the stream, got %v", err)
+			}
+			if len(frames) != len(test.want) {
+				t.Fatalf("expected %d frames, got %d", len(test.want), len(frames))
+			}
+			for i, frame := range frames {
+				if !bytes.Equal(frame, test.want[i]) {
+					t.Errorf("frame %d:\n got %x\nwant %x", i, frame, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestReadFrameDoesNotWaitForFakeLength checks that buffered frames behind a fake header are returned
+// without waiting for the announced length on an open connection
+func TestReadFrameDoesNotWaitForFakeLength(t *testing.T) {
+	frame33 := encodeFrame(t, "3.3", 1)
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+	go pipeWriter.Write(concat(fakeHeader(1000), frame33))
+
+	result := make(chan []byte, 1)
+	go func() {
+		frame, _ := NewFrameReader(pipeReader).ReadFrame()
+		result <- frame
+	}()
+
+	select {
+	case frame := <-result:
+		if !bytes.Equal(frame, frame33) {
+			t.Errorf("got %x, want %x", frame, frame33)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadFrame waited for the length of the fake header")
+	}
+}
+
+// TestReadFrameKeepsPartialFrame checks that a failed read doesn't lose the bytes of an incomplete frame
+func TestReadFrameKeepsPartialFrame(t *testing.T) {
+	frame33 := encodeFrame(t, "3.3", 1)
+	errTimeout := errors.New("timeout")
+	r := io.MultiReader(
+		bytes.NewReader(frame33[:10]),
+		iotest.ErrReader(errTimeout),
+	)
+	reader := NewFrameReader(&retryReader{first: r, then: bytes.NewReader(frame33[10:])})
+
+	if _, err := reader.ReadFrame(); !errors.Is(err, errTimeout) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatalf("reading the rest of the frame failed: %v", err)
+	}
+	if !bytes.Equal(frame, frame33) {
+		t.Errorf("got %x, want %x", frame, frame33)
+	}
+}
+
+// retryReader reads from first until it fails once and then continues with then
+type retryReader struct {
+	first  io.Reader
+	then   io.Reader
+	failed bool
+}
+
+func (r *retryReader) Read(p []byte) (int, error) {
+	if !r.failed {
+		n, err := r.first.Read(p)
+		if err != nil {
+			r.failed = true
+		}
+		return n, err
+	}
+	return r.then.Read(p)
+}
@@ -0,0 +1,15 @@
+package parser
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+const HmacSize = sha256.Size
+
+// CalculateHmac returns the HMAC-SHA256 of the given bytes which replaces the crc since protocol 3.4
+func CalculateHmac(bytes, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(bytes)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/commands"
+)
+
+const Prefix55AA uint32 = 0x000055AA
+const Suffix55AA uint32 = 0x0000AA55
+
+// HeaderSize of a 55AA frame.
+// It consists of: prefix (4), sequence (4), command (4) and length (4)
+const HeaderSize = 16
+
+const crcSize = 4
+const suffixSize = 4
+const returnCodeSize = 4
+
+// versionHeaderSize is the size of the "3.x" version string followed by 12 zero bytes
+const versionHeaderSize = 15
+
+var ErrCrcMismatch = errors.New("crc of the received frame does not match")
+var ErrHmacMismatch = errors.New("hmac of the received frame does not match")
+var ErrPrefixMismatch = errors.New("prefix of the received frame does not match")
+var ErrMalformedFrame = errors.New("the received frame is malformed")
+
+// Message is a single decoded tuya frame
+type Message struct {
+	SequenceNr uint32
+	Command    commands.Type
+	// ReturnCode is only sent by the device
+	ReturnCode    uint32
+	HasReturnCode bool
+	// Payload is the decrypted plaintext of the frame
+	Payload []byte
+}
+
+// EncodeMessage encrypts and frames the message as the given protocol version requires.
+// Information has been taken from: https://github.com/codetheweb/tuyapi/blob/master/lib/message-parser.js
+func EncodeMessage(msg Message, version string, key []byte) ([]byte, error) {
+	if version == "3.5" {
+		return encode6699(msg, version, key)
+	}
+
+	data, err := encryptPayload(msg, version, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.HasReturnCode {
+		returnCode := make([]byte, returnCodeSize)
+		binary.BigEndian.PutUint32(returnCode, msg.ReturnCode)
+		data = append(returnCode, data...)
+	}
+
+	integritySize := crcSize
+	if usesHmac(version) {
+		integritySize = HmacSize
+	}
+
+	frame := make([]byte, HeaderSize+len(data)+integritySize+suffixSize)
+	binary.BigEndian.PutUint32(frame[0:], Prefix55AA)
+	binary.BigEndian.PutUint32(frame[4:], msg.SequenceNr)
+	binary.BigEndian.PutUint32(frame[8:], uint32(msg.Command))
+	binary.BigEndian.PutUint32(frame[12:], uint32(len(data)+integritySize+suffixSize))
+	copy(frame[HeaderSize:], data)
+
+	integrityOffset := HeaderSize + len(data)
+	if usesHmac(version) {
+		copy(frame[integrityOffset:], CalculateHmac(frame[:integrityOffset], key))
+	} else {
+		binary.BigEndian.PutUint32(frame[integrityOffset:], CalculateCrc(frame[:integrityOffset]))
+	}
+	binary.BigEndian.PutUint32(frame[len(frame)-suffixSize:], Suffix55AA)
+
+	return frame, nil
+}
+
+// DecodeMessage validates and decrypts a full frame.
+// fromDevice has to be set if the frame has been sent by a device and therefore may contain a return code.
+// The sequence number and command of the returned Message are set even if the frame couldn't be verified or decrypted
+func DecodeMessage(frame []byte, version string, key []byte, fromDevice bool) (Message, error) {
+	if len(frame) < HeaderSize+crcSize+suffixSize {
+		return Message{}, fmt.Errorf("%w: tuya packet is too short. Length: %d", ErrMalformedFrame, len(frame))
+	}
+	switch prefix := binary.BigEndian.Uint32(frame[0:4]); prefix {
+	case Prefix55AA:
+	case Prefix6699:
+		return decode6699(frame, version, key, fromDevice)
+	default:
+		return Message{}, fmt.Errorf("%w: 0x%08x", ErrPrefixMismatch, prefix)
+	}
+
+	packetPayloadSize := binary.BigEndian.Uint32(frame[12:16])
+	if uint32(len(frame)-HeaderSize) != packetPayloadSize {
+		return Message{}, fmt.Errorf("%w: mismatch between expected packet size (%d) and actual size: %d", ErrMalformedFrame, packetPayloadSize, len(frame)-HeaderSize)
+	}
+	if suffix := binary.BigEndian.Uint32(frame[len(frame)-suffixSize:]); suffix != Suffix55AA {
+		return Message{}, fmt.Errorf("%w: suffix does not match: 0x%08x", ErrMalformedFrame, suffix)
+	}
+
+	msg := Message{
+		SequenceNr: binary.BigEndian.Uint32(frame[4:8]),
+		Command:    commands.Type(binary.BigEndian.Uint32(frame[8:12])),
+	}
+
+	integritySize := crcSize
+	if usesHmac(version) {
+		integritySize = HmacSize
+	}
+	if len(frame) < HeaderSize+integritySize+suffixSize {
+		return msg, fmt.Errorf("%w: tuya packet is too short. Length: %d", ErrMalformedFrame, len(frame))
+	}
+	integrityOffset := len(frame) - integritySize - suffixSize
+	if usesHmac(version) {
+		if !hmac.Equal(frame[integrityOffset:integrityOffset+integritySize], CalculateHmac(frame[:integrityOffset], key)) {
+			return msg, ErrHmacMismatch
+		}
+	} else if binary.BigEndian.Uint32(frame[integrityOffset:]) != CalculateCrc(frame[:integrityOffset]) {
+		return msg, ErrCrcMismatch
+	}
+
+	data := frame[HeaderSize:integrityOffset]
+
+	// The return code isn't always sent, we can only guess by its value.
+	// Take a look: https://github.com/codetheweb/tuyapi/blob/d88fd6c84b228b42f0b6aedd84f0ac3cdb1a5523/lib/message-parser.js#L161
+	if fromDevice && len(data) >= returnCodeSize {
+		if returnCode := binary.BigEndian.Uint32(data[0:returnCodeSize]); returnCode&0xFFFFFF00 == 0 {
+			msg.ReturnCode = returnCode
+			msg.HasReturnCode = true
+			data = data[returnCodeSize:]
+		}
+	}
+
+	// Error messages are often sent as plaintext
+	if msg.ReturnCode != 0 && len(trimVersionHeader(data))%blockSize != 0 {
+		msg.Payload = data
+		return msg, nil
+	}
+
+	payload, err := decryptPayload(data, version, key)
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = payload
+	return msg, nil
+}
+
+// encryptPayload encrypts the plaintext payload of the message
+func encryptPayload(msg Message, version string, key []byte) ([]byte, error) {
+	if version == "3.4" {
+		plaintext := msg.Payload
+		if hasVersionHeader(msg.Command) {
+			plaintext = append(versionHeader(version), plaintext...)
+		}
+		return EncryptAESWithECB(plaintext, key)
+	}
+
+	if version == "3.1" {
+		return encryptPayload31(msg, key)
+	}
+
+	if len(msg.Payload) == 0 {
+		return nil, nil
+	}
+	encrypted, err := EncryptAESWithECB(msg.Payload, key)
+	if err != nil {
+		return nil, err
+	}
+	if hasVersionHeader(msg.Command) {
+		encrypted = append(versionHeader("3.3"), encrypted...)
+	}
+	return encrypted, nil
+}
+
+// decryptPayload decrypts the payload and removes any version header
+func decryptPayload(data []byte, version string, key []byte) ([]byte, error) {
+	var err error
+	switch version {
+	case "3.4":
+		if len(data) == 0 {
+			return nil, nil
+		}
+		data, err = DecryptAESWithECB(data, key)
+		if err != nil {
+			return nil, err
+		}
+		return trimVersionHeader(data), nil
+	case "3.1":
+		return decryptPayload31(data, key)
+	default:
+		// The version header isn't encrypted
+		data = trimVersionHeader(data)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return DecryptAESWithECB(data, key)
+}
+
+// usesHmac returns if the frames are secured with a HMAC instead of a crc
+func usesHmac(version string) bool {
+	return version == "3.4"
+}
+
+// hasVersionHeader returns if the payload of the command is prefixed with a version header
+func hasVersionHeader(command commands.Type) bool {
+	switch command {
+	case commands.DP_QUERY, commands.DP_QUERY_NEW, commands.DP_REFRESH, commands.HEART_BEAT,
+		commands.SESS_KEY_NEG_START, commands.SESS_KEY_NEG_RESP, commands.SESS_KEY_NEG_FINISH:
+		return false
+	}
+	return true
+}
+
+// versionHeader returns the version string followed by 12 zero bytes
+func versionHeader(version string) []byte {
+	header := make([]byte, versionHeaderSize)
+	copy(header, version)
+	return header
+}
+
+// trimVersionHeader removes a leading "3.x" version header
+func trimVersionHeader(data []byte) []byte {
+	if len(data) >= versionHeaderSize && bytes.HasPrefix(data, []byte("3.")) {
+		return data[versionHeaderSize:]
+	}
+	return data
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/commands"
+)
+
+// signatureSize of the md5 signature following the "3.1" version string
+const signatureSize = 16
+
+var ErrSignatureMismatch = errors.New("md5 signature of the received payload does not match")
+
+// encryptPayload31 encrypts the payload as required by protocol 3.1.
+// Only CONTROL messages are encrypted, everything else is sent as plaintext
+func encryptPayload31(msg Message, key []byte) ([]byte, error) {
+	if msg.Command != commands.CONTROL {
+		return msg.Payload, nil
+	}
+
+	encrypted, err := EncryptAESWithECB(msg.Payload, key)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(encrypted)
+
+	data := []byte("3.1")
+	data = append(data, signature31(encoded, key)...)
+	data = append(data, encoded...)
+	return data, nil
+}
+
+// decryptPayload31 decrypts an encrypted 3.1 payload. Plaintext payloads are returned unchanged
+func decryptPayload31(data, key []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("3.1")) {
+		return data, nil
+	}
+	if len(data) < len("3.1")+signatureSize {
+		return nil, fmt.Errorf("%w: payload is too short to be signed", ErrMalformedFrame)
+	}
+
+	encoded := string(data[len("3.1")+signatureSize:])
+	if !bytes.Equal(data[len("3.1"):len("3.1")+signatureSize], signature31(encoded, key)) {
+		return nil, ErrSignatureMismatch
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptAESWithECB(encrypted, key)
+}
+
+// signature31 returns the middle part of the md5 hash over the base64 encoded payload and the key
+func signature31(encoded string, key []byte) []byte {
+	hash := md5.Sum([]byte("data=" + encoded + "||lpv=3.1||" + string(key)))
+	return []byte(hex.EncodeToString(hash[:])[8:24])
+}
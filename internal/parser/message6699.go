@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/commands"
+)
+
+const Prefix6699 uint32 = 0x00006699
+const Suffix6699 uint32 = 0x00009966
+
+// HeaderSize6699 of a 6699 frame used since protocol 3.5.
+// It consists of: prefix (4), reserved (2), sequence (4), command (4) and length (4)
+const HeaderSize6699 = 18
+
+const IvSize = 12
+const tagSize = 16
+
+// encode6699 encrypts and frames the message using AES-GCM as required since protocol 3.5
+func encode6699(msg Message, version string, key []byte) ([]byte, error) {
+	var plaintext []byte
+	if msg.HasReturnCode {
+		plaintext = binary.BigEndian.AppendUint32(plaintext, msg.ReturnCode)
+	}
+	if hasVersionHeader(msg.Command) {
+		plaintext = append(plaintext, versionHeader(version)...)
+	}
+	plaintext = append(plaintext, msg.Payload...)
+
+	iv := make([]byte, IvSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	// The length contains the iv, the ciphertext and the tag
+	frame := make([]byte, HeaderSize6699, HeaderSize6699+IvSize+len(plaintext)+tagSize+suffixSize)
+	binary.BigEndian.PutUint32(frame[0:], Prefix6699)
+	binary.BigEndian.PutUint32(frame[6:], msg.SequenceNr)
+	binary.BigEndian.PutUint32(frame[10:], uint32(msg.Command))
+	binary.BigEndian.PutUint32(frame[14:], uint32(IvSize+len(plaintext)+tagSize))
+
+	// The header without the prefix is authenticated as well
+	encrypted, err := EncryptAESWithGCM(plaintext, key, iv, frame[4:HeaderSize6699])
+	if err != nil {
+		return nil, err
+	}
+
+	frame = append(frame, iv...)
+	frame = append(frame, encrypted...)
+	frame = binary.BigEndian.AppendUint32(frame, Suffix6699)
+	return frame, nil
+}
+
+// decode6699 validates and decrypts a full 6699 frame
+func decode6699(frame []byte, version string, key []byte, fromDevice bool) (Message, error) {
+	if len(frame) < HeaderSize6699+IvSize+tagSize+suffixSize {
+		return Message{}, fmt.Errorf("%w: tuya packet is too short. Length: %d", ErrMalformedFrame, len(frame))
+	}
+
+	packetPayloadSize := binary.BigEndian.Uint32(frame[14:18])
+	if uint32(len(frame)-HeaderSize6699-suffixSize) != packetPayloadSize {
+		return Message{}, fmt.Errorf("%w: mismatch between expected packet size (%d) and actual size: %d", ErrMalformedFrame, packetPayloadSize, len(frame)-HeaderSize6699-suffixSize)
+	}
+	if suffix := binary.BigEndian.Uint32(frame[len(frame)-suffixSize:]); suffix != Suffix6699 {
+		return Message{}, fmt.Errorf("%w: suffix does not match: 0x%08x", ErrMalformedFrame, suffix)
+	}
+
+	msg := Message{
+		SequenceNr: binary.BigEndian.Uint32(frame[6:10]),
+		Command:    commands.Type(binary.BigEndian.Uint32(frame[10:14])),
+	}
+
+	iv := frame[HeaderSize6699 : HeaderSize6699+IvSize]
+	plaintext, err := DecryptAESWithGCM(frame[HeaderSize6699+IvSize:len(frame)-suffixSize], key, iv, frame[4:HeaderSize6699])
+	if err != nil {
+		return msg, err
+	}
+	if fromDevice && len(plaintext) >= returnCodeSize {
+		if returnCode := binary.BigEndian.Uint32(plaintext[0:returnCodeSize]); returnCode&0xFFFFFF00 == 0 {
+			msg.ReturnCode = returnCode
+			msg.HasReturnCode = true
+			plaintext = plaintext[returnCodeSize:]
+		}
+	}
+	if len(plaintext) > 0 {
+		msg.Payload = trimVersionHeader(plaintext)
+	}
+	return msg, nil
+}
@@ -0,0 +1,28 @@
+package parser
+
+// NonceSize of the nonces exchanged during the session key negotiation since protocol 3.4
+const NonceSize = 16
+
+// DeriveSessionKey encrypts both XORed nonces with the local key
+func DeriveSessionKey(version string, localNonce, remoteNonce, key []byte) ([]byte, error) {
+	xored := make([]byte, NonceSize)
+	for i := range xored {
+		xored[i] = localNonce[i] ^ remoteNonce[i]
+	}
+
+	if version == "3.5" {
+		encrypted, err := EncryptAESWithGCM(xored, key, localNonce[:IvSize], nil)
+		if err != nil {
+			return nil, err
+		}
+		// The authentication tag isn't part of the key
+		return encrypted[:NonceSize], nil
+	}
+
+	encrypted, err := EncryptAESWithECB(xored, key)
+	if err != nil {
+		return nil, err
+	}
+	// ECB encrypts every block on its own, so the first block is the unpadded result
+	return encrypted[:NonceSize], nil
+}
@@ -1,63 +1,72 @@
 package ac
 
 import (
-	"errors"
-	"fmt"
-	"strconv"
+	"context"
+	"github.com/Binozo/GoTuya/pkg/tuya"
 )
 
 func (a *AC) IsOn() (bool, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return false, err
-		}
-		defer a.Disconnect()
+	return a.IsOnContext(context.Background())
+}
+
+func (a *AC) IsOnContext(ctx context.Context) (bool, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return false, err
 	}
-	currentStatus := a.GetCurrentStatus()
-	if onValue, ok := currentStatus[onDpsIndex]; ok {
-		return onValue.(bool), nil
-	} else {
-		return false, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
+	defer release()
+	value, err := a.GetDP(onDpsIndex)
+	if err != nil {
+		return false, err
 	}
+	return value.Bool()
 }
 
 func (a *AC) CurrentTemperature() (float64, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return 0, err
-		}
-		defer a.Disconnect()
+	return a.CurrentTemperatureContext(context.Background())
+}
+
+func (a *AC) CurrentTemperatureContext(ctx context.Context) (float64, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return 0, err
 	}
-	currentStatus := a.GetCurrentStatus()
-	if onValue, ok := currentStatus[temperatureDpsIndex]; ok {
-		return onValue.(float64), nil
-	} else {
-		return 0, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
+	defer release()
+	value, err := a.GetDP(temperatureDpsIndex)
+	if err != nil {
+		return 0, err
 	}
+	return value.Float()
 }
 
 func (a *AC) Power(powerOn bool) error {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
-	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex: powerOn,
+	return a.PowerContext(context.Background(), powerOn)
+}
+
+func (a *AC) PowerContext(ctx context.Context, powerOn bool) error {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex: tuya.BoolDP(powerOn),
 	})
 }
 
 func (a *AC) SetTemperature(temperature int) error {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
-	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex:          true,
-		temperatureDpsIndex: temperature,
+	return a.SetTemperatureContext(context.Background(), temperature)
+}
+
+func (a *AC) SetTemperatureContext(ctx context.Context, temperature int) error {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex:          tuya.BoolDP(true),
+		temperatureDpsIndex: tuya.IntegerDP(int64(temperature)),
 	})
 }
 
@@ -65,117 +74,138 @@ func (a *AC) SetTemperature(temperature int) error {
 // 1 is low,
 // 4 is high
 func (a *AC) SetFanIntensity(intensity int) error {
+	return a.SetFanIntensityContext(context.Background(), intensity)
+}
+
+func (a *AC) SetFanIntensityContext(ctx context.Context, intensity int) error {
 	if intensity < 1 || intensity > 4 {
-		return errors.New("intensity must be between 1 and 4")
+		return ErrInvalidFanIntensity
 	}
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
 	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex:           true,
-		fanIntensityDpsIndex: intensity,
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex:           tuya.BoolDP(true),
+		fanIntensityDpsIndex: tuya.IntegerDP(int64(intensity)),
 	})
 }
 
 // GetFanIntensity gets the current fan intensity on a scale between 1 and 4.
 func (a *AC) GetFanIntensity() (int, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return 0, err
-		}
-		defer a.Disconnect()
-	}
-	currentStatus := a.GetCurrentStatus()
-	if intensityValue, ok := currentStatus[fanIntensityDpsIndex]; ok {
-		return strconv.Atoi(intensityValue.(string))
-	} else {
-		return 0, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
-	}
+	return a.GetFanIntensityContext(context.Background())
+}
+
+func (a *AC) GetFanIntensityContext(ctx context.Context) (int, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	value, err := a.GetDP(fanIntensityDpsIndex)
+	if err != nil {
+		return 0, err
+	}
+	intensity, err := value.Int()
+	return int(intensity), err
 }
 
 func (a *AC) SetFanSwing(swing bool) error {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
-	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex:       true,
-		fanSwingDpsIndex: swing,
+	return a.SetFanSwingContext(context.Background(), swing)
+}
+
+func (a *AC) SetFanSwingContext(ctx context.Context, swing bool) error {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex:       tuya.BoolDP(true),
+		fanSwingDpsIndex: tuya.BoolDP(swing),
 	})
 }
 
 func (a *AC) GetFanSwinging() (bool, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return false, err
-		}
-		defer a.Disconnect()
+	return a.GetFanSwingingContext(context.Background())
+}
+
+func (a *AC) GetFanSwingingContext(ctx context.Context) (bool, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return false, err
 	}
-	currentStatus := a.GetCurrentStatus()
-	if intensityValue, ok := currentStatus[fanSwingDpsIndex]; ok {
-		return intensityValue.(bool), nil
-	} else {
-		return false, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
+	defer release()
+	value, err := a.GetDP(fanSwingDpsIndex)
+	if err != nil {
+		return false, err
 	}
+	return value.Bool()
 }
 
 func (a *AC) SetTurboMode(turbo bool) error {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
-	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex:        true,
-		turboModeDpsIndex: turbo,
+	return a.SetTurboModeContext(context.Background(), turbo)
+}
+
+func (a *AC) SetTurboModeContext(ctx context.Context, turbo bool) error {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex:        tuya.BoolDP(true),
+		turboModeDpsIndex: tuya.BoolDP(turbo),
 	})
 }
 
 func (a *AC) GetIsTurboEnabled() (bool, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return false, err
-		}
-		defer a.Disconnect()
+	return a.GetIsTurboEnabledContext(context.Background())
+}
+
+func (a *AC) GetIsTurboEnabledContext(ctx context.Context) (bool, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return false, err
 	}
-	currentStatus := a.GetCurrentStatus()
-	if turboValue, ok := currentStatus[turboModeDpsIndex]; ok {
-		return turboValue.(bool), nil
-	} else {
-		return false, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
+	defer release()
+	value, err := a.GetDP(turboModeDpsIndex)
+	if err != nil {
+		return false, err
 	}
+	return value.Bool()
 }
 
 func (a *AC) SetNightMode(nightMode bool) error {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return err
-		}
-		defer a.Disconnect()
-	}
-	return a.Set(map[string]interface{}{
-		onDpsIndex:        true,
-		nightModeDpsIndex: nightMode,
+	return a.SetNightModeContext(context.Background(), nightMode)
+}
+
+func (a *AC) SetNightModeContext(ctx context.Context, nightMode bool) error {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return a.SetDPsContext(ctx, map[string]tuya.DPValue{
+		onDpsIndex:        tuya.BoolDP(true),
+		nightModeDpsIndex: tuya.BoolDP(nightMode),
 	})
 }
 
 func (a *AC) GetIsNightModeEnabled() (bool, error) {
-	if !a.IsConnected() {
-		if err := a.Connect(); err != nil {
-			return false, err
-		}
-		defer a.Disconnect()
-	}
-	currentStatus := a.GetCurrentStatus()
-	if nightValue, ok := currentStatus[nightModeDpsIndex]; ok {
-		return nightValue.(bool), nil
-	} else {
-		return false, errors.New(fmt.Sprintf("dps index %s not contained in: %s", onDpsIndex, currentStatus))
+	return a.GetIsNightModeEnabledContext(context.Background())
+}
+
+func (a *AC) GetIsNightModeEnabledContext(ctx context.Context) (bool, error) {
+	release, err := a.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	value, err := a.GetDP(nightModeDpsIndex)
+	if err != nil {
+		return false, err
 	}
+	return value.Bool()
 }
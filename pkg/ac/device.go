@@ -6,9 +6,17 @@ type AC struct {
 	*tuya.Device
 }
 
-// CreateAC creates an A/C instance to control it easily with the included api
+// CreateAC creates an A/C instance to control it easily with the included api.
+// The protocol version is detected when connecting
 func CreateAC(ip, deviceId string, key string) *AC {
 	return &AC{
-		tuya.CreateDevice(ip, deviceId, key, tuya.Version_3_3),
+		tuya.CreateDevice(ip, deviceId, key, tuya.Version_Auto),
+	}
+}
+
+// CreateACByID creates an A/C instance whose IP is resolved from the discovery broadcasts
+func CreateACByID(deviceId string, key string) *AC {
+	return &AC{
+		tuya.CreateDeviceByID(deviceId, key, tuya.Version_Auto),
 	}
 }
@@ -0,0 +1,12 @@
+package ac
+
+import (
+	"errors"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+)
+
+// ErrDpsNotReported is returned if the A/C didn't report the dps holding the requested value
+var ErrDpsNotReported = tuya.ErrDpsNotReported
+
+// ErrInvalidFanIntensity is returned if the fan intensity isn't between 1 and 4
+var ErrInvalidFanIntensity = errors.New("intensity must be between 1 and 4")
@@ -0,0 +1,211 @@
+// Package metrics exposes the dps and the protocol health of tuya devices as Prometheus metrics
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// counter families in the order they are exported
+var counters = []struct {
+	name string
+	help string
+}{
+	{"tuya_requests_total", "Requests sent to the device by command."},
+	{"tuya_request_errors_total", "Failed requests by command and error type."},
+	{"tuya_connects_total", "Connection attempts."},
+	{"tuya_connect_errors_total", "Failed connection attempts by error type."},
+	{"tuya_reconnects_total", "Lost connections which have been re-established."},
+	{"tuya_connections_lost_total", "Connections dropped by the device or closed because it stopped answering."},
+}
+
+// Collector records the protocol metrics of its devices and serves them along with their dps.
+// Numeric and boolean dps are exported as gauges, all other dps are skipped
+type Collector struct {
+	// mutex guards the devices and the recorded metrics
+	mutex   sync.Mutex
+	devices map[string]*tuya.Device
+	// counters by family name
+	counters map[string]map[series]uint64
+	// durations of the requests
+	durations map[series]*histogram
+}
+
+// CreateCollector without any devices
+func CreateCollector() *Collector {
+	c := &Collector{
+		devices:   map[string]*tuya.Device{},
+		counters:  map[string]map[series]uint64{},
+		durations: map[series]*histogram{},
+	}
+	for _, family := range counters {
+		c.counters[family.name] = map[series]uint64{}
+	}
+	return c
+}
+
+// Add the Device and observe its traffic. Has to be called before the Device is used,
+// because the Collector becomes the Observer of the Device
+func (c *Collector) Add(device *tuya.Device) {
+	device.Observer = c
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.devices[device.DeviceID] = device
+}
+
+// Remove the Device. Its recorded metrics are kept
+func (c *Collector) Remove(deviceId string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.devices, deviceId)
+}
+
+// Connected counts the connection attempt
+func (c *Collector) Connected(deviceId string, reconnect bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counters["tuya_connects_total"][series{device: deviceId}]++
+	if err != nil {
+		c.counters["tuya_connect_errors_total"][series{device: deviceId, errType: errorType(err)}]++
+	} else if reconnect {
+		c.counters["tuya_reconnects_total"][series{device: deviceId}]++
+	}
+}
+
+// ConnectionLost counts the lost connection
+func (c *Collector) ConnectionLost(deviceId string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counters["tuya_connections_lost_total"][series{device: deviceId}]++
+}
+
+// RequestDone counts the request and records its latency
+func (c *Collector) RequestDone(deviceId string, command string, latency time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	request := series{device: deviceId, command: command}
+	c.counters["tuya_requests_total"][request]++
+	if err != nil {
+		c.counters["tuya_request_errors_total"][series{device: deviceId, command: command, errType: errorType(err)}]++
+		return
+	}
+
+	// Failed requests usually time out, which would distort the latency
+	durations, ok := c.durations[request]
+	if !ok {
+		durations = newHistogram()
+		c.durations[request] = durations
+	}
+	durations.observe(latency.Seconds())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer := bufio.NewWriter(w)
+	c.write(writer)
+	writer.Flush()
+}
+
+// write every metric family
+func (c *Collector) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	devices := make([]*tuya.Device, 0, len(c.devices))
+	for _, device := range c.devices {
+		devices = append(devices, device)
+	}
+	c.mutex.Unlock()
+
+	// The status is read without holding the mutex, because the Device may be notifying the Collector
+	connected := map[series]float64{}
+	dps := map[series]float64{}
+	for _, device := range devices {
+		connected[series{device: device.DeviceID}] = boolValue(device.IsConnected())
+		for index, value := range device.GetCurrentDPs() {
+			if number, ok := numericValue(value); ok {
+				dps[series{device: device.DeviceID, dps: index}] = number
+			}
+		}
+	}
+	writeGauges(w, "tuya_connected", "Whether the connection to the device is open.", connected)
+	writeGauges(w, "tuya_dps_value", "Last reported value of the numeric and boolean dps. Booleans are exported as 0 or 1.", dps)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, family := range counters {
+		samples := c.counters[family.name]
+		writeHeader(w, family.name, family.help, "counter")
+		for _, key := range sortedSeries(samples) {
+			writeSample(w, family.name, key.labels(), float64(samples[key]))
+		}
+	}
+	writeHeader(w, "tuya_request_duration_seconds", "Round-trip latency of the answered requests.", "histogram")
+	for _, key := range sortedSeries(c.durations) {
+		writeHistogram(w, "tuya_request_duration_seconds", key.labels(), c.durations[key])
+	}
+}
+
+func writeGauges(w *bufio.Writer, name, help string, samples map[series]float64) {
+	writeHeader(w, name, help, "gauge")
+	for _, key := range sortedSeries(samples) {
+		writeSample(w, name, key.labels(), samples[key])
+	}
+}
+
+// numericValue converts numeric and boolean dps values
+func numericValue(value tuya.DPValue) (float64, bool) {
+	switch value.Kind() {
+	case tuya.DPBool:
+		boolean, err := value.Bool()
+		return boolValue(boolean), err == nil
+	case tuya.DPInteger:
+		number, err := value.Float()
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// errorType classifies the error for the type label
+func errorType(err error) string {
+	var deviceErr *tuya.DeviceError
+	var commandErr *tuya.UnexpectedCommandError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, tuya.ErrWrongKey):
+		return "wrong_key"
+	case errors.Is(err, tuya.ErrVersionNotDetected):
+		return "version_not_detected"
+	case errors.Is(err, tuya.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, tuya.ErrDeviceNotFound):
+		return "device_not_found"
+	case errors.Is(err, tuya.ErrConnectionClosed), errors.Is(err, tuya.ErrNotConnected):
+		return "connection_closed"
+	case errors.Is(err, tuya.ErrCrcMismatch), errors.Is(err, tuya.ErrHmacMismatch), errors.Is(err, tuya.ErrDecryptionFailed),
+		errors.Is(err, tuya.ErrSignatureMismatch), errors.Is(err, tuya.ErrInvalidPadding), errors.Is(err, tuya.ErrMalformedFrame),
+		errors.Is(err, tuya.ErrPrefixMismatch):
+		return "malformed_frame"
+	case errors.As(err, &deviceErr):
+		return "device_error"
+	case errors.As(err, &commandErr):
+		return "unexpected_command"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
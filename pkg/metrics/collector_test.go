@@ -0,0 +1,191 @@
+package metrics_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/metrics"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// scrape serves the metrics of the collector and returns the samples by name and labels
+func scrape(t *testing.T, collector *metrics.Collector) (map[string]float64, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+
+	body := recorder.Body.String()
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		separator := strings.LastIndexByte(line, ' ')
+		if separator < 0 {
+			t.Fatalf("malformed sample %q", line)
+		}
+		value, err := strconv.ParseFloat(line[separator+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		samples[line[:separator]] = value
+	}
+	return samples, body
+}
+
+func TestCollector(t *testing.T) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_3, map[string]interface{}{
+		"1": true,
+		"2": 21,
+		"4": "cold",
+	})
+	collector := metrics.CreateCollector()
+	device := server.Device()
+	collector.Add(device)
+	if err := device.Connect(); err != nil {
+		t.Fatalf("connecting failed: %v", err)
+	}
+	defer device.Disconnect()
+
+	for range 3 {
+		if _, err := device.FetchStatus(); err != nil {
+			t.Fatalf("fetching the status failed: %v", err)
+		}
+	}
+	if err := device.Set(map[string]interface{}{"2": 23}); err != nil {
+		t.Fatalf("setting failed: %v", err)
+	}
+	server.Inject(tuyatest.Fault{Command: tuyatest.Query, Delay: 200 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := device.FetchStatusContext(ctx); !errors.Is(err, tuya.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	samples, body := scrape(t, collector)
+	label := `device="` + tuyatest.DeviceID + `"`
+	want := map[string]float64{
+		`tuya_connected{` + label + `}`:                                              1,
+		`tuya_dps_value{` + label + `,dps="1"}`:                                      1,
+		`tuya_dps_value{` + label + `,dps="2"}`:                                      23,
+		`tuya_connects_total{` + label + `}`:                                         1,
+		`tuya_requests_total{` + label + `,command="DP_QUERY"}`:                      5,
+		`tuya_requests_total{` + label + `,command="CONTROL"}`:                       1,
+		`tuya_request_errors_total{` + label + `,command="DP_QUERY",type="timeout"}`: 1,
+		`tuya_request_duration_seconds_count{` + label + `,command="DP_QUERY"}`:      4,
+		`tuya_request_duration_seconds_count{` + label + `,command="CONTROL"}`:       1,
+	}
+	for sample, value := range want {
+		if got, ok := samples[sample]; !ok || got != value {
+			t.Errorf("%s = %v (exported: %t), want %v", sample, got, ok, value)
+		}
+	}
+	for sample := range samples {
+		if strings.Contains(sample, `dps="4"`) {
+			t.Errorf("the enum dps has been exported: %s", sample)
+		}
+	}
+	for _, family := range []string{"tuya_connected", "tuya_dps_value", "tuya_requests_total", "tuya_request_duration_seconds"} {
+		if !strings.Contains(body, "# TYPE "+family+" ") || !strings.Contains(body, "# HELP "+family+" ") {
+			t.Errorf("the header of %s is missing", family)
+		}
+	}
+
+	for _, command := range []string{"DP_QUERY", "CONTROL"} {
+		checkHistogram(t, samples, label+`,command="`+command+`"`)
+	}
+}
+
+// checkHistogram checks that the buckets of the histogram are cumulative and match its count
+func checkHistogram(t *testing.T, samples map[string]float64, labels string) {
+	t.Helper()
+	name := "tuya_request_duration_seconds"
+	var previous float64
+	var buckets int
+	for _, bound := range []string{"0.005", "0.01", "0.025", "0.05", "0.1", "0.25", "0.5", "1", "2.5", "5", "10", "+Inf"} {
+		count, ok := samples[name+`_bucket{`+labels+`,le="`+bound+`"}`]
+		if !ok {
+			t.Errorf("the bucket %s of {%s} is missing", bound, labels)
+			continue
+		}
+		if count < previous {
+			t.Errorf("the bucket %s of {%s} decreases from %v to %v", bound, labels, previous, count)
+		}
+		previous = count
+		buckets++
+	}
+	if count := samples[name+`_count{`+labels+`}`]; buckets > 0 && previous != count {
+		t.Errorf("the +Inf bucket of {%s} is %v, but the count is %v", labels, previous, count)
+	}
+	if sum, ok := samples[name+`_sum{`+labels+`}`]; !ok || sum <= 0 {
+		t.Errorf("the sum of {%s} is %v (exported: %t)", labels, sum, ok)
+	}
+}
+
+func TestCollectorErrorTypes(t *testing.T) {
+	tests := []struct {
+		errType string
+		err     error
+	}{
+		{"wrong_key", fmt.Errorf("%w: %w", tuya.ErrWrongKey, tuya.ErrCrcMismatch)},
+		{"timeout", tuya.ErrTimeout},
+		{"canceled", context.Canceled},
+		{"connection_closed", tuya.ErrConnectionClosed},
+		{"connection_closed", tuya.ErrNotConnected},
+		{"malformed_frame", tuya.ErrCrcMismatch},
+		{"malformed_frame", tuya.ErrHmacMismatch},
+		{"malformed_frame", tuya.ErrDecryptionFailed},
+		{"device_not_found", tuya.ErrDeviceNotFound},
+		{"device_error", &tuya.DeviceError{}},
+		{"unexpected_command", &tuya.UnexpectedCommandError{}},
+		{"other", errors.New("something else")},
+	}
+	collector := metrics.CreateCollector()
+	want := map[string]float64{}
+	for _, test := range tests {
+		collector.RequestDone("device", "CONTROL", time.Millisecond, test.err)
+		collector.Connected("device", false, test.err)
+		want[`tuya_request_errors_total{device="device",command="CONTROL",type="`+test.errType+`"}`]++
+		want[`tuya_connect_errors_total{device="device",type="`+test.errType+`"}`]++
+	}
+	collector.Connected("device", true, nil)
+	collector.ConnectionLost("device")
+	want[`tuya_requests_total{device="device",command="CONTROL"}`] = float64(len(tests))
+	want[`tuya_connects_total{device="device"}`] = float64(len(tests) + 1)
+	want[`tuya_reconnects_total{device="device"}`] = 1
+	want[`tuya_connections_lost_total{device="device"}`] = 1
+
+	samples, _ := scrape(t, collector)
+	for sample, value := range want {
+		if samples[sample] != value {
+			t.Errorf("%s = %v, want %v", sample, samples[sample], value)
+		}
+	}
+	// Failed requests don't distort the latency
+	if _, ok := samples[`tuya_request_duration_seconds_count{device="device",command="CONTROL"}`]; ok {
+		t.Error("the latency of failed requests has been recorded")
+	}
+}
+
+func TestCollectorEscapesLabels(t *testing.T) {
+	collector := metrics.CreateCollector()
+	collector.ConnectionLost("a\"b\\c\nd")
+
+	_, body := scrape(t, collector)
+	if want := `tuya_connections_lost_total{device="a\"b\\c\nd"} 1` + "\n"; !strings.Contains(body, want) {
+		t.Errorf("the label hasn't been escaped:\n%s", body)
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// label of a sample
+type label struct {
+	name  string
+	value string
+}
+
+// series identifies the samples of a metric. Empty fields aren't exported as labels
+type series struct {
+	device  string
+	dps     string
+	command string
+	errType string
+}
+
+func (s series) labels() []label {
+	labels := []label{{"device", s.device}}
+	if s.dps != "" {
+		labels = append(labels, label{"dps", s.dps})
+	}
+	if s.command != "" {
+		labels = append(labels, label{"command", s.command})
+	}
+	if s.errType != "" {
+		labels = append(labels, label{"type", s.errType})
+	}
+	return labels
+}
+
+func compareSeries(a, b series) int {
+	return cmp.Or(
+		strings.Compare(a.device, b.device),
+		compareDps(a.dps, b.dps),
+		strings.Compare(a.command, b.command),
+		strings.Compare(a.errType, b.errType),
+	)
+}
+
+// compareDps sorts the dps numerically
+func compareDps(a, b string) int {
+	aIndex, aErr := strconv.Atoi(a)
+	bIndex, bErr := strconv.Atoi(b)
+	if aErr != nil || bErr != nil {
+		return strings.Compare(a, b)
+	}
+	return cmp.Compare(aIndex, bIndex)
+}
+
+// sortedSeries returns the keys of the samples in a stable order
+func sortedSeries[V any](samples map[series]V) []series {
+	keys := make([]series, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareSeries)
+	return keys
+}
+
+// histogram of observed durations in seconds
+type histogram struct {
+	// counts per bucket, not cumulative. The last count is the +Inf bucket
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// latencyBuckets are the upper bounds of the request duration buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	bucket, _ := slices.BinarySearch(latencyBuckets, value)
+	h.counts[bucket]++
+	h.sum += value
+	h.count++
+}
+
+// writeHeader writes the help and type of a metric family in the Prometheus text format
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// writeSample writes a single sample in the Prometheus text format
+func writeSample(w *bufio.Writer, name string, labels []label, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.name + `="` + escapeLabelValue(l.value) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatValue(value) + "\n")
+}
+
+// writeHistogram writes the cumulative buckets, the sum and the count of the histogram
+func writeHistogram(w *bufio.Writer, name string, labels []label, h *histogram) {
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		bound := math.Inf(1)
+		if i < len(latencyBuckets) {
+			bound = latencyBuckets[i]
+		}
+		writeSample(w, name+"_bucket", append(slices.Clip(labels), label{"le", formatValue(bound)}), float64(cumulative))
+	}
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,35 @@
+package tuya
+
+import (
+	"context"
+	"sync"
+)
+
+// Acquire connects to the Device if there is no connection yet and keeps the connection open
+// until the returned release function has been called by every user.
+// A connection opened by Connect stays open. This allows concurrent calls to share a single connection
+func (d *Device) Acquire(ctx context.Context) (func(), error) {
+	d.usersMutex.Lock()
+	defer d.usersMutex.Unlock()
+
+	if !d.IsConnected() {
+		if err := d.connectContext(ctx); err != nil {
+			return nil, err
+		}
+		d.temporary = true
+	}
+	d.users++
+	return sync.OnceFunc(d.release), nil
+}
+
+// release the connection acquired by Acquire
+func (d *Device) release() {
+	d.usersMutex.Lock()
+	defer d.usersMutex.Unlock()
+
+	d.users--
+	if d.users == 0 && d.temporary {
+		d.temporary = false
+		d.Disconnect()
+	}
+}
@@ -0,0 +1,70 @@
+package tuya
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// versionProbeTimeout bounds connecting with a single version while detecting it.
+// Devices usually drop or ignore a client speaking another version
+const versionProbeTimeout = 5 * time.Second
+
+// probedVersions in the order they are tried if the Device didn't announce its version.
+// Protocol 3.2 is only tried if it has been announced, because it is framed like 3.3
+var probedVersions = []Version{Version_3_3, Version_3_4, Version_3_5, Version_3_1}
+
+// connectDetectingVersion tries the remembered version, the announced version and then every other version until the Device answers.
+// The version which fetched the current status is remembered
+func (d *Device) connectDetectingVersion(ctx context.Context) error {
+	previous := d.ProtocolVersion()
+	var errs []error
+	for _, version := range d.candidateVersions(previous) {
+		connection, err := d.dial(ctx)
+		if err != nil {
+			// The Device can't be reached at all, so trying other versions is pointless
+			d.setVersion(previous)
+			return contextError(ctx, err)
+		}
+
+		d.setVersion(version)
+		probeCtx, cancel := context.WithTimeout(ctx, versionProbeTimeout)
+		err = d.open(probeCtx, connection)
+		cancel()
+		if err == nil {
+			if version != previous {
+				d.logger().Info("detected protocol version", slog.String("version", string(version)))
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			d.setVersion(previous)
+			return contextError(ctx, err)
+		}
+		d.logger().Debug("device didn't answer to protocol version", slog.String("version", string(version)), slog.Any("error", err))
+		errs = append(errs, fmt.Errorf("version %s: %w", version, err))
+	}
+
+	d.setVersion(previous)
+	return fmt.Errorf("%w: %w", ErrVersionNotDetected, errors.Join(errs...))
+}
+
+// candidateVersions returns the versions to try in order without duplicates
+func (d *Device) candidateVersions(previous Version) []Version {
+	var candidates []Version
+	if previous.isKnown() {
+		candidates = append(candidates, previous)
+	}
+	if last, ok := lastAnnouncement(d.DeviceID); ok && last.device.Version.isKnown() && !slices.Contains(candidates, last.device.Version) {
+		candidates = append(candidates, last.device.Version)
+	}
+	for _, version := range probedVersions {
+		if !slices.Contains(candidates, version) {
+			candidates = append(candidates, version)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,47 @@
+package tuya
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := ReconnectPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for attempt, backoff := range want {
+		if got := policy.backoff(attempt); got != backoff*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, backoff*time.Millisecond)
+		}
+	}
+	// Doubling must not overflow after many attempts
+	if got := policy.backoff(100); got != time.Second {
+		t.Errorf("backoff(100) = %s, want the MaxBackoff", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := ReconnectPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+	for attempt, base := range []time.Duration{100, 200, 400, 800, 1000} {
+		base *= time.Millisecond
+		low, high := base*8/10, base*12/10
+		var varied bool
+		for range 1000 {
+			backoff := policy.backoff(attempt)
+			if backoff < low || backoff > high {
+				t.Fatalf("backoff(%d) = %s is out of %s to %s", attempt, backoff, low, high)
+			}
+			varied = varied || backoff != base
+		}
+		if !varied {
+			t.Errorf("backoff(%d) hasn't been randomized", attempt)
+		}
+	}
+
+	// A jitter above 1 must not result in a negative backoff
+	policy.Jitter = 1.5
+	for range 1000 {
+		if backoff := policy.backoff(0); backoff < 0 {
+			t.Fatalf("negative backoff %s", backoff)
+		}
+	}
+}
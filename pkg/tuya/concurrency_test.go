@@ -0,0 +1,159 @@
+package tuya_test
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/ac"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// callers running concurrently and the calls each of them makes
+const (
+	callers = 8
+	calls   = 20
+)
+
+// startAC starts a fake A/C which is closed when the test ends
+func startAC(t *testing.T, version tuya.Version) (*tuyatest.Server, *ac.AC) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, version, map[string]interface{}{
+		"1": false,
+		"2": 20,
+	})
+	return server, &ac.AC{Device: server.Device()}
+}
+
+// runConcurrently runs the call for every caller and iteration and collects the errors
+func runConcurrently(call func(caller, iteration int) error) []error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	for caller := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for iteration := range calls {
+				if err := call(caller, iteration); err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// callAC alternates between reading and setting the A/C
+func callAC(myAc *ac.AC, caller, iteration int) error {
+	if iteration%2 == 0 {
+		_, err := myAc.IsOn()
+		return err
+	}
+	return myAc.SetTemperature(16 + caller)
+}
+
+func TestConcurrentCallsShareTheConnection(t *testing.T) {
+	for _, version := range []tuya.Version{tuya.Version_3_3, tuya.Version_3_5} {
+		t.Run(string(version), func(t *testing.T) {
+			server, myAc := startAC(t, version)
+
+			errs := runConcurrently(func(caller, iteration int) error {
+				return callAC(myAc, caller, iteration)
+			})
+			for _, err := range errs {
+				t.Errorf("concurrent call failed: %v", err)
+			}
+
+			if myAc.IsConnected() {
+				t.Error("the connection hasn't been closed by the last caller")
+			}
+			if dps := server.Dps(); dps["1"] != true {
+				t.Errorf("the A/C hasn't been turned on: %v", dps)
+			}
+		})
+	}
+}
+
+func TestConcurrentCallsWithConnect(t *testing.T) {
+	_, myAc := startAC(t, tuya.Version_3_4)
+	if err := myAc.Connect(); err != nil {
+		t.Fatalf("connecting failed: %v", err)
+	}
+	defer myAc.Disconnect()
+
+	errs := runConcurrently(func(caller, iteration int) error {
+		return callAC(myAc, caller, iteration)
+	})
+	for _, err := range errs {
+		t.Errorf("concurrent call failed: %v", err)
+	}
+	if !myAc.IsConnected() {
+		t.Error("the connection opened by Connect has been closed")
+	}
+}
+
+func TestConcurrentCallsWithDisconnect(t *testing.T) {
+	for _, version := range []tuya.Version{tuya.Version_3_3, tuya.Version_3_5} {
+		t.Run(string(version), func(t *testing.T) {
+			_, myAc := startAC(t, version)
+
+			errs := runConcurrently(func(caller, iteration int) error {
+				if caller == 0 {
+					myAc.Disconnect()
+					return nil
+				}
+				return callAC(myAc, caller, iteration)
+			})
+			// Calls whose connection has been closed by Disconnect fail, but nothing else may go wrong
+			for _, err := range errs {
+				if !errors.Is(err, tuya.ErrConnectionClosed) && !errors.Is(err, tuya.ErrNotConnected) && !errors.Is(err, net.ErrClosed) {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+
+			myAc.Disconnect()
+			if myAc.IsConnected() {
+				t.Error("Disconnect didn't close the connection")
+			}
+			// The Device is still usable
+			if _, err := myAc.IsOn(); err != nil {
+				t.Errorf("calling after Disconnect failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestSessionKeyNegotiationDoesNotBlock checks that a slow handshake neither blocks reading the state nor Disconnect
+func TestSessionKeyNegotiationDoesNotBlock(t *testing.T) {
+	for _, version := range []tuya.Version{tuya.Version_3_4, tuya.Version_3_5} {
+		t.Run(string(version), func(t *testing.T) {
+			server, myAc := startAC(t, version)
+			server.Inject(tuyatest.Fault{Command: tuyatest.SessionKeyStart, Delay: time.Second})
+
+			connected := make(chan error, 1)
+			go func() { connected <- myAc.Connect() }()
+			time.Sleep(100 * time.Millisecond)
+
+			start := time.Now()
+			if myAc.IsConnected() {
+				t.Error("connected before the session key has been negotiated")
+			}
+			myAc.Disconnect()
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("IsConnected and Disconnect waited %s for the handshake", elapsed)
+			}
+			if err := <-connected; err == nil {
+				t.Error("Connect succeeded although Disconnect has been called during the handshake")
+			}
+			if myAc.IsConnected() {
+				t.Error("the connection has been published after Disconnect")
+			}
+		})
+	}
+}
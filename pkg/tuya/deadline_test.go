@@ -0,0 +1,37 @@
+package tuya
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestBindDeadlineRelease checks that the deadline is cleared even if the context is done while releasing
+func TestBindDeadlineRelease(t *testing.T) {
+	var mutex sync.Mutex
+	var deadline time.Time
+	setDeadline := func(d time.Time) error {
+		if !d.IsZero() {
+			// The cancellation is applied while the connection is released
+			time.Sleep(20 * time.Millisecond)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		deadline = d
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := bindDeadline(ctx, setDeadline)
+	cancel()
+	time.Sleep(5 * time.Millisecond)
+	release()
+	time.Sleep(40 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !deadline.IsZero() {
+		t.Errorf("the deadline %s has been left on the connection", deadline)
+	}
+}
@@ -1,6 +1,14 @@
 package tuya
 
-import "net"
+import (
+	"github.com/Binozo/GoTuya/internal/parser"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Device generic tuya api interface
 type Device struct {
@@ -10,21 +18,96 @@ type Device struct {
 	DeviceID string
 	// Key for the encrypted traffic
 	Key []byte
-	// Version for the different tuya api specifications
+	// Version for the different tuya api specifications.
+	// Version_Auto detects it when connecting. Use ProtocolVersion to read it once the Device is in use
 	Version Version
-	// currentSequenceNr used for communication
-	currentSequenceNr int
-	conn              *net.Conn
+	// versionMutex guards the Version once the Device is in use
+	versionMutex sync.Mutex
+	// detectsVersion is set once the Device has been connected with Version_Auto, guarded by the connectMutex
+	detectsVersion bool
+	// DeviceType decides how the Device is queried.
+	// It is switched automatically if the Device rejects the query
+	DeviceType DeviceType
+	// Schema validates and scales the values passed to Set and SetDPs
+	// and decodes the values returned by GetDP and GetCurrentDPs. Dps without a schema are passed unchecked
+	Schema Schema
+	// DpsToRequest are queried from DeviceType_22 devices.
+	// They are detected when connecting unless they have been set. Use DetectDps to detect them again
+	DpsToRequest []int
+	// typeMutex guards the DeviceType and the DpsToRequest once the Device is in use
+	typeMutex sync.Mutex
+	// Port the Device listens on. Defaults to 6668
+	Port int
+	// Dialer opens the connection to the Device. Defaults to a net.Dialer
+	Dialer Dialer
+	// HeartbeatInterval in which the Device is pinged to keep the connection alive.
+	// Tuya devices drop idle connections after roughly 30 seconds. Set to 0 to disable
+	HeartbeatInterval time.Duration
+	// Reconnect re-establishes a lost connection if set. See DefaultReconnectPolicy
+	Reconnect *ReconnectPolicy
+	// Logger receives the connection lifecycle at info level and every frame at debug level.
+	// The local key is redacted from the logged payloads. Nothing is logged if nil
+	Logger *slog.Logger
+	// Observer is notified about every connection attempt and request if set
+	Observer Observer
+	// resolvesIP from the discovery broadcasts if the Device has been created by its id only
+	resolvesIP bool
+	// usersMutex guards the users and serializes acquiring the connection
+	usersMutex sync.Mutex
+	// users of the connection opened by Acquire
+	users int
+	// temporary is set if the connection has been opened by Acquire and is closed by the last user
+	temporary bool
+	// connectMutex serializes connecting and disconnecting
+	connectMutex sync.Mutex
+	// mutex guards the connection and serializes writing to it
+	mutex sync.Mutex
+	// sequenceNr of the last sent frame
+	sequenceNr atomic.Uint32
+	conn       net.Conn
+	// opening is the connection whose session key is being negotiated. Closed by Disconnect
+	opening net.Conn
+	// reader splits the incoming stream into frames
+	reader *parser.FrameReader
+	// sessionKey negotiated for the current connection since protocol 3.4
+	sessionKey []byte
+	// stopHeartbeat is closed when the connection is closed
+	stopHeartbeat chan struct{}
+	// stopReconnect is closed to stop a running reconnect
+	stopReconnect chan struct{}
+	// lost is set from losing the connection until it is re-established or Disconnect is called
+	lost bool
+	// pendingMutex guards the pending requests
+	pendingMutex sync.Mutex
+	// pending requests waiting for their answer by sequence number
+	pending map[uint32]*pendingRequest
+	// closed is closed when the read loop stops
+	closed chan struct{}
+	// statusMutex guards the currentStatus and the subscribers
+	statusMutex sync.Mutex
 	// currentStatus cached responses and device status
 	currentStatus response
+	subscribers   map[chan StatusUpdate]struct{}
 }
 
 // CreateDevice for generic tuya devices
 func CreateDevice(ip string, deviceId string, key string, version Version) *Device {
 	return &Device{
-		IP:       ip,
-		DeviceID: deviceId,
-		Key:      []byte(key),
-		Version:  version,
+		IP:                ip,
+		DeviceID:          deviceId,
+		Key:               []byte(key),
+		Version:           version,
+		Port:              defaultPort,
+		DeviceType:        detectDeviceType(deviceId),
+		DpsToRequest:      slices.Clone(defaultDpsToRequest),
+		HeartbeatInterval: defaultHeartbeatInterval,
 	}
 }
+
+// CreateDeviceByID for generic tuya devices whose IP may change.
+// The IP is resolved from the discovery broadcasts when connecting and resolved again if the Device can't be reached
+func CreateDeviceByID(deviceId string, key string, version Version) *Device {
+	device := CreateDevice("", deviceId, key, version)
+	device.resolvesIP = true
+	return device
+}
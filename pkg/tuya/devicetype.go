@@ -0,0 +1,20 @@
+package tuya
+
+type DeviceType string
+
+// DeviceType_Default devices answer to the regular DP_QUERY command
+const DeviceType_Default DeviceType = "default"
+
+// DeviceType_22 devices (usually identified by their 22 characters long id) ignore DP_QUERY.
+// They need to be queried with CONTROL_NEW and a list of the requested dps
+const DeviceType_22 DeviceType = "device22"
+
+const device22IdLength = 22
+
+// detectDeviceType guesses the DeviceType by the device id
+func detectDeviceType(deviceId string) DeviceType {
+	if len(deviceId) == device22IdLength {
+		return DeviceType_22
+	}
+	return DeviceType_Default
+}
@@ -0,0 +1,20 @@
+package tuya
+
+import (
+	"context"
+	"net"
+)
+
+// Dialer opens connections to the devices, e.g. through a jump host or with tcp keepalives.
+// It is implemented by net.Dialer
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialerFunc is a function used as Dialer. This allows any net.Conn to be used, e.g. a net.Pipe
+type DialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialContext calls the function
+func (f DialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
@@ -0,0 +1,200 @@
+package tuya
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ports the devices broadcast their presence on.
+// Information has been taken from: https://github.com/jasonacox/tinytuya/blob/master/tinytuya/scanner.py
+const (
+	// discoveryPortPlain receives the plaintext broadcasts of protocol 3.1 devices
+	discoveryPortPlain = 6666
+	// discoveryPortEncrypted receives the AES-ECB encrypted broadcasts since protocol 3.3
+	discoveryPortEncrypted = 6667
+	// discoveryPort35 receives the AES-GCM encrypted broadcasts since protocol 3.5
+	discoveryPort35 = 7000
+)
+
+// maxDatagramSize of a broadcast
+const maxDatagramSize = 4096
+
+// udpKey every device uses to encrypt its broadcasts
+var udpKey = func() []byte {
+	hash := md5.Sum([]byte("yGAdlopoPVldABfn"))
+	return hash[:]
+}()
+
+// DiscoveredDevice announced itself on the local network
+type DiscoveredDevice struct {
+	// IP of the Device
+	IP string
+	// DeviceID (gwId) of the Device
+	DeviceID string
+	// ProductKey identifies the kind of the Device
+	ProductKey string
+	// Version of the tuya api the Device speaks
+	Version Version
+}
+
+// broadcast sent by the devices
+type broadcast struct {
+	IP         string `json:"ip"`
+	GwID       string `json:"gwId"`
+	ProductKey string `json:"productKey"`
+	Version    string `json:"version"`
+}
+
+// Discover listens for the broadcasts of the tuya devices on the local network until the context is done.
+// Every Device is sent once and again whenever its IP or Version changes.
+// The returned channel is closed when the context is done.
+// Ports which can't be bound are skipped, an error is only returned if none of them can be bound
+func Discover(ctx context.Context) (<-chan DiscoveredDevice, error) {
+	since := time.Now()
+	release, err := listenForBroadcasts()
+	if err != nil {
+		return nil, err
+	}
+
+	discovered := make(chan DiscoveredDevice)
+	go func() {
+		defer close(discovered)
+		defer release()
+		known := map[string]DiscoveredDevice{}
+		for {
+			devices, changed := announcementsSince(since)
+			for _, device := range devices {
+				if known[device.DeviceID] == device {
+					continue
+				}
+				known[device.DeviceID] = device
+				select {
+				case discovered <- device:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return discovered, nil
+}
+
+// listenerMutex guards the shared listener
+var listenerMutex sync.Mutex
+
+// listenerUsers of the shared listener. It is stopped once the last user released it
+var listenerUsers int
+
+// listenerConnections bound to the discovery ports while the shared listener runs
+var listenerConnections []net.PacketConn
+
+// listenForBroadcasts starts the shared listener announcing every received broadcast if it isn't running yet.
+// The discovery ports can only be bound once, so every Discover call and every resolve share a single listener.
+// The returned function releases the listener
+func listenForBroadcasts() (func(), error) {
+	listenerMutex.Lock()
+	defer listenerMutex.Unlock()
+
+	if listenerUsers == 0 {
+		connections, err := bindDiscoveryPorts()
+		if err != nil {
+			return nil, err
+		}
+		for _, connection := range connections {
+			go receiveBroadcasts(connection)
+		}
+		listenerConnections = connections
+	}
+	listenerUsers++
+
+	return sync.OnceFunc(func() {
+		listenerMutex.Lock()
+		defer listenerMutex.Unlock()
+		listenerUsers--
+		if listenerUsers == 0 {
+			for _, connection := range listenerConnections {
+				connection.Close()
+			}
+			listenerConnections = nil
+		}
+	}), nil
+}
+
+// bindDiscoveryPorts binds every discovery port which isn't taken
+func bindDiscoveryPorts() ([]net.PacketConn, error) {
+	var connections []net.PacketConn
+	var errs []error
+	for _, port := range []int{discoveryPortPlain, discoveryPortEncrypted, discoveryPort35} {
+		connection, err := net.ListenPacket("udp4", ":"+strconv.Itoa(port))
+		if err != nil {
+			// The port may be taken by another service, the devices broadcasting on the other ports are still found
+			errs = append(errs, err)
+			continue
+		}
+		connections = append(connections, connection)
+	}
+	if len(connections) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return connections, nil
+}
+
+// receiveBroadcasts announces every valid broadcast received on the connection until it is closed
+func receiveBroadcasts(connection net.PacketConn) {
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := connection.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		device, err := parseBroadcast(buffer[:n])
+		if err != nil {
+			// Not every datagram on these ports is a tuya broadcast
+			continue
+		}
+		announce(device)
+	}
+}
+
+// parseBroadcast decodes and decrypts a single broadcast
+func parseBroadcast(datagram []byte) (DiscoveredDevice, error) {
+	// Protocol 3.1 devices broadcast plaintext, all others encrypt it with the udpKey.
+	// Broadcasts are always secured with a crc, so they are decoded like protocol 3.3 frames.
+	// 6699 frames are detected by their prefix
+	var payload broadcast
+	var err error
+	for _, version := range []Version{Version_3_1, Version_3_3} {
+		var msg parser.Message
+		msg, err = parser.DecodeMessage(datagram, string(version), udpKey, true)
+		if err != nil {
+			continue
+		}
+		if err = json.Unmarshal(msg.Payload, &payload); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+	if payload.GwID == "" || payload.IP == "" {
+		return DiscoveredDevice{}, errors.New("the broadcast doesn't identify the device")
+	}
+	return DiscoveredDevice{
+		IP:         payload.IP,
+		DeviceID:   payload.GwID,
+		ProductKey: payload.ProductKey,
+		Version:    Version(payload.Version),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package tuya
+
+import (
+	"testing"
+
+	"github.com/Binozo/GoTuya/internal/commands"
+	"github.com/Binozo/GoTuya/internal/parser"
+)
+
+// udpNew is the command of the broadcasts
+const udpNew commands.Type = 0x13
+
+// encodeBroadcast encodes the payload like a device of the version broadcasts it
+func encodeBroadcast(t *testing.T, payload string, version Version, key []byte) []byte {
+	t.Helper()
+	datagram, err := parser.EncodeMessage(parser.Message{Command: udpNew, Payload: []byte(payload)}, string(version), key)
+	if err != nil {
+		t.Fatalf("encoding the broadcast failed: %v", err)
+	}
+	return datagram
+}
+
+func TestParseBroadcast(t *testing.T) {
+	for _, version := range []Version{Version_3_1, Version_3_3, Version_3_5} {
+		t.Run(string(version), func(t *testing.T) {
+			payload := `{"ip":"192.168.1.23","gwId":"15580880bcaac262j6eg","active":2,"ability":0,"mode":0,` +
+				`"encrypt":true,"productKey":"keyjup78v54myhan","version":"` + string(version) + `"}`
+			device, err := parseBroadcast(encodeBroadcast(t, payload, version, udpKey))
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+			want := DiscoveredDevice{
+				IP:         "192.168.1.23",
+				DeviceID:   "15580880bcaac262j6eg",
+				ProductKey: "keyjup78v54myhan",
+				Version:    version,
+			}
+			if device != want {
+				t.Errorf("got %+v, want %+v", device, want)
+			}
+		})
+	}
+}
+
+func TestParseBroadcastInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		datagram []byte
+	}{
+		{"missing gwId", encodeBroadcast(t, `{"ip":"192.168.1.23","version":"3.3"}`, Version_3_3, udpKey)},
+		{"missing ip", encodeBroadcast(t, `{"gwId":"15580880bcaac262j6eg","version":"3.3"}`, Version_3_3, udpKey)},
+		{"other key", encodeBroadcast(t, `{"ip":"192.168.1.23","gwId":"15580880bcaac262j6eg"}`, Version_3_5, []byte("0123456789abcdef"))},
+		{"no json", encodeBroadcast(t, `15580880bcaac262j6eg`, Version_3_1, udpKey)},
+		{"no frame", []byte("garbage which doesn't look like a frame at all")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if device, err := parseBroadcast(test.datagram); err == nil {
+				t.Errorf("expected an error, got %+v", device)
+			}
+		})
+	}
+}
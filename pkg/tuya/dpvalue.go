@@ -0,0 +1,333 @@
+package tuya
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// DPKind is the type of a DPValue
+type DPKind int
+
+const (
+	// DPBool is a switch like the power of an A/C
+	DPBool DPKind = iota + 1
+	// DPInteger is a number like the temperature. Tuya calls it "value"
+	DPInteger
+	// DPEnum is one of a fixed set of strings like the mode of an A/C
+	DPEnum
+	// DPString is a free text
+	DPString
+	// DPRaw is binary data, transferred base64 encoded
+	DPRaw
+	// DPBitmap is a set of flags like the faults of a Device
+	DPBitmap
+)
+
+func (k DPKind) String() string {
+	switch k {
+	case DPBool:
+		return "bool"
+	case DPInteger:
+		return "integer"
+	case DPEnum:
+		return "enum"
+	case DPString:
+		return "string"
+	case DPRaw:
+		return "raw"
+	case DPBitmap:
+		return "bitmap"
+	}
+	return "invalid"
+}
+
+// DPValue is the typed value of a single dps.
+// The accessors convert between the kinds where this is lossless, e.g. an enum "3" is read as integer 3
+type DPValue struct {
+	kind    DPKind
+	boolean bool
+	integer int64
+	// scale of the integer, which is divided by 10^scale
+	scale  int
+	text   string
+	raw    []byte
+	bitmap uint64
+}
+
+// BoolDP creates a DPBool value
+func BoolDP(value bool) DPValue {
+	return DPValue{kind: DPBool, boolean: value}
+}
+
+// IntegerDP creates a DPInteger value
+func IntegerDP(value int64) DPValue {
+	return DPValue{kind: DPInteger, integer: value}
+}
+
+// maxScale of DPInteger values. 10^18 is the largest power of ten fitting into an int64
+const maxScale = 18
+
+// ScaledDP creates a DPInteger value with a fraction. raw is transferred, raw / 10^scale is the actual value.
+// Values of a Device with a Schema are scaled like its Schema specifies.
+// The scale has to be between 0 and 18, otherwise the value is invalid like the zero DPValue
+func ScaledDP(raw int64, scale int) DPValue {
+	if !validScale(scale) {
+		return DPValue{}
+	}
+	return DPValue{kind: DPInteger, integer: raw, scale: scale}
+}
+
+// validScale returns if 10^scale fits into an int64
+func validScale(scale int) bool {
+	return scale >= 0 && scale <= maxScale
+}
+
+// EnumDP creates a DPEnum value
+func EnumDP(value string) DPValue {
+	return DPValue{kind: DPEnum, text: value}
+}
+
+// StringDP creates a DPString value
+func StringDP(value string) DPValue {
+	return DPValue{kind: DPString, text: value}
+}
+
+// RawDP creates a DPRaw value
+func RawDP(value []byte) DPValue {
+	return DPValue{kind: DPRaw, raw: value}
+}
+
+// BitmapDP creates a DPBitmap value
+func BitmapDP(value uint64) DPValue {
+	return DPValue{kind: DPBitmap, bitmap: value}
+}
+
+// DPValueOf converts a value reported by the Device or passed to Set.
+// Json can't tell enums, raw data and bitmaps apart from strings and integers, so they are read as DPString and DPInteger.
+// Unsigned integers are read as DPInteger too unless they overflow an int64. Numbers with a fraction, which tuya devices don't send, are kept as DPString
+func DPValueOf(value interface{}) (DPValue, error) {
+	switch v := value.(type) {
+	case DPValue:
+		return v, nil
+	case bool:
+		return BoolDP(v), nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) >= math.MaxInt64 {
+			return StringDP(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		}
+		return IntegerDP(int64(v)), nil
+	case float32:
+		return DPValueOf(float64(v))
+	case int:
+		return IntegerDP(int64(v)), nil
+	case int8:
+		return IntegerDP(int64(v)), nil
+	case int16:
+		return IntegerDP(int64(v)), nil
+	case int32:
+		return IntegerDP(int64(v)), nil
+	case int64:
+		return IntegerDP(v), nil
+	case uint:
+		return DPValueOf(uint64(v))
+	case uint8:
+		return IntegerDP(int64(v)), nil
+	case uint16:
+		return IntegerDP(int64(v)), nil
+	case uint32:
+		return IntegerDP(int64(v)), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			// Only a bitmap with the highest bit set doesn't fit into an integer
+			return BitmapDP(v), nil
+		}
+		return IntegerDP(int64(v)), nil
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			return IntegerDP(integer), nil
+		}
+		return StringDP(v.String()), nil
+	case string:
+		return StringDP(v), nil
+	case []byte:
+		return RawDP(v), nil
+	}
+	return DPValue{}, &DPConversionError{Value: fmt.Sprint(value)}
+}
+
+// Kind of the value. The zero DPValue has no valid kind
+func (v DPValue) Kind() DPKind {
+	return v.kind
+}
+
+// Bool returns the value of a DPBool. Integers 0 and 1 and strings like "true" are converted
+func (v DPValue) Bool() (bool, error) {
+	switch v.kind {
+	case DPBool:
+		return v.boolean, nil
+	case DPInteger:
+		if v.scale == 0 && (v.integer == 0 || v.integer == 1) {
+			return v.integer == 1, nil
+		}
+	case DPEnum, DPString:
+		if boolean, err := strconv.ParseBool(v.text); err == nil {
+			return boolean, nil
+		}
+	}
+	return false, v.conversionError(DPBool)
+}
+
+// Int returns the value of a DPInteger without a fraction. Numeric strings and bitmaps fitting into an int64 are converted
+func (v DPValue) Int() (int64, error) {
+	switch v.kind {
+	case DPInteger:
+		if v.integer%pow10(v.scale) == 0 {
+			return v.integer / pow10(v.scale), nil
+		}
+	case DPEnum, DPString:
+		if integer, err := strconv.ParseInt(v.text, 10, 64); err == nil {
+			return integer, nil
+		}
+	case DPBitmap:
+		if v.bitmap <= math.MaxInt64 {
+			return int64(v.bitmap), nil
+		}
+	}
+	return 0, v.conversionError(DPInteger)
+}
+
+// Float returns the value of a DPInteger including its fraction. Numeric strings are converted
+func (v DPValue) Float() (float64, error) {
+	switch v.kind {
+	case DPInteger:
+		return float64(v.integer) / math.Pow10(v.scale), nil
+	case DPEnum, DPString:
+		if number, err := strconv.ParseFloat(v.text, 64); err == nil {
+			return number, nil
+		}
+	}
+	return 0, v.conversionError(DPInteger)
+}
+
+// Enum returns the value of a DPEnum or a DPString. Integers are converted, because many enums are numeric like "1" to "4"
+func (v DPValue) Enum() (string, error) {
+	switch v.kind {
+	case DPEnum, DPString:
+		return v.text, nil
+	case DPInteger:
+		if v.scale == 0 {
+			return strconv.FormatInt(v.integer, 10), nil
+		}
+	}
+	return "", v.conversionError(DPEnum)
+}
+
+// Text returns the value of a DPString or a DPEnum
+func (v DPValue) Text() (string, error) {
+	if v.kind == DPString || v.kind == DPEnum {
+		return v.text, nil
+	}
+	return "", v.conversionError(DPString)
+}
+
+// Raw returns the value of a DPRaw. Base64 encoded strings are decoded
+func (v DPValue) Raw() ([]byte, error) {
+	switch v.kind {
+	case DPRaw:
+		return v.raw, nil
+	case DPString:
+		if raw, err := base64.StdEncoding.DecodeString(v.text); err == nil {
+			return raw, nil
+		}
+	}
+	return nil, v.conversionError(DPRaw)
+}
+
+// Bitmap returns the value of a DPBitmap. Non-negative integers are converted
+func (v DPValue) Bitmap() (uint64, error) {
+	switch v.kind {
+	case DPBitmap:
+		return v.bitmap, nil
+	case DPInteger:
+		if v.scale == 0 && v.integer >= 0 {
+			return uint64(v.integer), nil
+		}
+	}
+	return 0, v.conversionError(DPBitmap)
+}
+
+// String formats the value for humans
+func (v DPValue) String() string {
+	switch v.kind {
+	case DPBool:
+		return strconv.FormatBool(v.boolean)
+	case DPInteger:
+		if v.scale == 0 {
+			return strconv.FormatInt(v.integer, 10)
+		}
+		return strconv.FormatFloat(float64(v.integer)/math.Pow10(v.scale), 'f', v.scale, 64)
+	case DPEnum, DPString:
+		return v.text
+	case DPRaw:
+		return base64.StdEncoding.EncodeToString(v.raw)
+	case DPBitmap:
+		return "0b" + strconv.FormatUint(v.bitmap, 2)
+	}
+	return "<invalid>"
+}
+
+// jsonValue returns the value as sent to the Device. Scaled integers are sent as raw value
+func (v DPValue) jsonValue() (interface{}, error) {
+	switch v.kind {
+	case DPBool:
+		return v.boolean, nil
+	case DPInteger:
+		return v.integer, nil
+	case DPEnum, DPString:
+		return v.text, nil
+	case DPRaw:
+		return base64.StdEncoding.EncodeToString(v.raw), nil
+	case DPBitmap:
+		return v.bitmap, nil
+	}
+	return nil, &DPConversionError{Value: v.String()}
+}
+
+// MarshalJSON encodes the value like the Device expects it
+func (v DPValue) MarshalJSON() ([]byte, error) {
+	value, err := v.jsonValue()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// UnmarshalJSON decodes the value like DPValueOf
+func (v *DPValue) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	converted, err := DPValueOf(value)
+	if err != nil {
+		return err
+	}
+	*v = converted
+	return nil
+}
+
+// pow10 returns 10^exponent
+func pow10(exponent int) int64 {
+	result := int64(1)
+	for range exponent {
+		result *= 10
+	}
+	return result
+}
+
+func (v DPValue) conversionError(to DPKind) error {
+	return &DPConversionError{From: v.kind, To: to, Value: v.String()}
+}
@@ -0,0 +1,90 @@
+package tuya_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+)
+
+func TestScaledDP(t *testing.T) {
+	tests := []struct {
+		raw       int64
+		scale     int
+		wantFloat float64
+		wantText  string
+		// wantInt is only checked if the value has no fraction
+		wantInt int64
+		hasInt  bool
+	}{
+		{215, 1, 21.5, "21.5", 0, false},
+		{220, 1, 22, "22.0", 22, true},
+		{-5, 2, -0.05, "-0.05", 0, false},
+		{7, 0, 7, "7", 7, true},
+		{1_000_000_000_000_000_000, 18, 1, "1.000000000000000000", 1, true},
+	}
+	for _, test := range tests {
+		value := tuya.ScaledDP(test.raw, test.scale)
+		if number, err := value.Float(); err != nil || number != test.wantFloat {
+			t.Errorf("ScaledDP(%d, %d).Float() = %v, %v, want %v", test.raw, test.scale, number, err, test.wantFloat)
+		}
+		if text := value.String(); text != test.wantText {
+			t.Errorf("ScaledDP(%d, %d).String() = %q, want %q", test.raw, test.scale, text, test.wantText)
+		}
+		integer, err := value.Int()
+		if test.hasInt && (err != nil || integer != test.wantInt) {
+			t.Errorf("ScaledDP(%d, %d).Int() = %d, %v, want %d", test.raw, test.scale, integer, err, test.wantInt)
+		}
+		if !test.hasInt && err == nil {
+			t.Errorf("ScaledDP(%d, %d).Int() = %d, expected an error for the fraction", test.raw, test.scale, integer)
+		}
+	}
+}
+
+func TestScaledDPInvalidScale(t *testing.T) {
+	for _, scale := range []int{-1, 19, 64} {
+		value := tuya.ScaledDP(1, scale)
+		var conversionErr *tuya.DPConversionError
+		if _, err := value.Int(); !errors.As(err, &conversionErr) {
+			t.Errorf("ScaledDP(1, %d).Int() returned %v instead of a DPConversionError", scale, err)
+		}
+		if _, err := value.Float(); !errors.As(err, &conversionErr) {
+			t.Errorf("ScaledDP(1, %d).Float() returned %v instead of a DPConversionError", scale, err)
+		}
+		if text := value.String(); text != "<invalid>" {
+			t.Errorf("ScaledDP(1, %d).String() = %q, want <invalid>", scale, text)
+		}
+	}
+}
+
+func TestDPValueOfIntegers(t *testing.T) {
+	values := []interface{}{
+		int(20), int8(20), int16(20), int32(20), int64(20),
+		uint(20), uint8(20), uint16(20), uint32(20), uint64(20),
+		float32(20), float64(20), json.Number("20"),
+	}
+	for _, value := range values {
+		converted, err := tuya.DPValueOf(value)
+		if err != nil {
+			t.Errorf("DPValueOf(%T) failed: %v", value, err)
+			continue
+		}
+		if converted.Kind() != tuya.DPInteger {
+			t.Errorf("DPValueOf(%T) has the kind %s instead of integer", value, converted.Kind())
+		}
+		if integer, err := converted.Int(); err != nil || integer != 20 {
+			t.Errorf("DPValueOf(%T).Int() = %d, %v, want 20", value, integer, err)
+		}
+	}
+
+	// Unsigned integers overflowing an int64 are kept as bitmap
+	converted, err := tuya.DPValueOf(uint64(math.MaxUint64))
+	if err != nil || converted.Kind() != tuya.DPBitmap {
+		t.Errorf("DPValueOf(MaxUint64) = %s, %v, want a bitmap", converted.Kind(), err)
+	}
+	if bitmap, err := converted.Bitmap(); err != nil || bitmap != math.MaxUint64 {
+		t.Errorf("DPValueOf(MaxUint64).Bitmap() = %d, %v", bitmap, err)
+	}
+}
@@ -0,0 +1,119 @@
+package tuya
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/parser"
+)
+
+// ErrNotConnected is returned if a request is sent without an active connection
+var ErrNotConnected = errors.New("there is no active connection")
+
+// ErrConnectionClosed is returned if the connection has been closed while waiting for an answer
+var ErrConnectionClosed = errors.New("the connection has been closed")
+
+// ErrTimeout is returned if the Device didn't answer in time.
+// It is returned along with context.DeadlineExceeded if the deadline of the context has been exceeded
+var ErrTimeout = errors.New("the device didn't answer in time")
+
+// ErrPrefixMismatch is returned if a received frame doesn't start with a known prefix
+var ErrPrefixMismatch = parser.ErrPrefixMismatch
+
+// ErrMalformedFrame is returned if a received frame is truncated or its length doesn't match
+var ErrMalformedFrame = parser.ErrMalformedFrame
+
+// ErrCrcMismatch is returned if a received frame has been corrupted
+var ErrCrcMismatch = parser.ErrCrcMismatch
+
+// ErrHmacMismatch is returned if a received frame hasn't been secured with the expected key.
+// It is returned along with ErrWrongKey unless the key has been proven by the session key negotiation
+var ErrHmacMismatch = parser.ErrHmacMismatch
+
+// ErrSignatureMismatch is returned along with ErrWrongKey if a received protocol 3.1 payload has been signed with another key
+var ErrSignatureMismatch = parser.ErrSignatureMismatch
+
+// ErrDecryptionFailed is returned if a received payload couldn't be decrypted.
+// It is returned along with ErrWrongKey unless the key has been proven by the session key negotiation
+var ErrDecryptionFailed = parser.ErrDecryptionFailed
+
+// ErrInvalidPadding is returned along with ErrDecryptionFailed if a decrypted payload isn't padded correctly
+var ErrInvalidPadding = parser.ErrInvalidPadding
+
+// ErrWrongKey is returned if the Device rejected the local key during the session key negotiation
+// or a received frame couldn't be verified or decrypted with it before the key has been proven
+var ErrWrongKey = errors.New("the local key is probably wrong or has been rotated")
+
+// ErrVersionNotDetected is returned if the Device didn't answer to any version while detecting it.
+// It is returned along with the error of every tried version, which may include ErrWrongKey
+var ErrVersionNotDetected = errors.New("the device didn't answer to any protocol version")
+
+// ErrDeviceNotFound is returned if the IP of the Device couldn't be resolved from the discovery broadcasts
+var ErrDeviceNotFound = errors.New("the device didn't announce itself")
+
+// ErrDpsNotReported is returned by GetDP if the Device didn't report the dps
+var ErrDpsNotReported = errors.New("the device didn't report the dps")
+
+// ErrInvalidSchema is returned by ParseSchema if the schema can't be parsed
+var ErrInvalidSchema = errors.New("the dps schema is invalid")
+
+// ErrInvalidValue is returned by Set if a value doesn't match the Schema of its dps
+var ErrInvalidValue = errors.New("the value doesn't match the schema of the dps")
+
+// ErrReadOnlyDps is returned by Set if the Schema marks the dps as read-only
+var ErrReadOnlyDps = errors.New("the dps is read-only")
+
+// ErrNoDps is returned by DetectDps if the Device didn't report any dps
+var ErrNoDps = errors.New("the device didn't report any dps")
+
+// ErrDeviceExists is returned if a Device with the same id is already managed by the Manager
+var ErrDeviceExists = errors.New("the device is already managed")
+
+// ErrDeviceNotManaged is returned if the Manager doesn't know the Device
+var ErrDeviceNotManaged = errors.New("the device isn't managed")
+
+// ErrManagerClosed is returned if a Device is added to a closed Manager
+var ErrManagerClosed = errors.New("the manager has been closed")
+
+// DeviceError is returned if the Device answered with a non-zero return code
+type DeviceError struct {
+	// ReturnCode sent by the Device
+	ReturnCode int
+	// Message sent by the Device along with the return code. Might be empty
+	Message string
+}
+
+func (e *DeviceError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("the device answered with return code %d", e.ReturnCode)
+	}
+	return fmt.Sprintf("the device answered with return code %d: %s", e.ReturnCode, e.Message)
+}
+
+// UnexpectedCommandError is returned if the Device answered with another command than expected
+type UnexpectedCommandError struct {
+	// Expected command
+	Expected int
+	// Received command
+	Received int
+}
+
+func (e *UnexpectedCommandError) Error() string {
+	return fmt.Sprintf("the device answered with command %d instead of %d", e.Received, e.Expected)
+}
+
+// DPConversionError is returned if a DPValue can't be converted to the requested kind
+type DPConversionError struct {
+	// From is the kind of the value. 0 if the value isn't supported at all
+	From DPKind
+	// To is the requested kind. 0 if the value isn't supported at all
+	To DPKind
+	// Value that couldn't be converted
+	Value string
+}
+
+func (e *DPConversionError) Error() string {
+	if e.From == 0 || e.To == 0 {
+		return fmt.Sprintf("%q isn't a valid dps value", e.Value)
+	}
+	return fmt.Sprintf("can't convert the %s value %q to %s", e.From, e.Value, e.To)
+}
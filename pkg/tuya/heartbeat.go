@@ -0,0 +1,69 @@
+package tuya
+
+import (
+	"context"
+	"errors"
+	"github.com/Binozo/GoTuya/internal/commands"
+	"log/slog"
+	"net"
+	"time"
+)
+
+const defaultHeartbeatInterval = 10 * time.Second
+
+// maxMissedHeartbeats until the connection is considered dead
+const maxMissedHeartbeats = 2
+
+// heartbeatLoop pings the Device in the given interval until stop is closed.
+// The connection is closed if the Device stops answering
+func (d *Device) heartbeatLoop(connection net.Conn, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := d.sendHeartbeat(interval)
+		if err == nil {
+			missed = 0
+			continue
+		}
+
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			missed++
+			d.logger().Debug("missed heartbeat", slog.Int("missed", missed))
+			if missed < maxMissedHeartbeats {
+				continue
+			}
+		case errors.Is(err, ErrConnectionClosed), errors.As(err, &netErr):
+		default:
+			// The Device answered, so the connection is still alive
+			missed = 0
+			continue
+		}
+
+		// The connection is dead
+		d.connectionLost(connection)
+		return
+	}
+}
+
+// sendHeartbeat pings the Device and waits for the pong
+func (d *Device) sendHeartbeat(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	heartbeatPayload := payload{
+		deviceId: d.DeviceID,
+		t:        time.Now(),
+	}
+	_, err := d.request(ctx, heartbeatPayload, commands.HEART_BEAT, []commands.Type{commands.HEART_BEAT})
+	return err
+}
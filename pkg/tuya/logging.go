@@ -0,0 +1,69 @@
+package tuya
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"log/slog"
+)
+
+// redacted replaces the local key in logged payloads
+const redacted = "[REDACTED]"
+
+// discardHandler drops every record of a Device without a Logger
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// LogValue identifies the Device in log records without revealing its Key
+func (d *Device) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", d.DeviceID),
+		slog.String("ip", d.Address()),
+		slog.String("version", string(d.ProtocolVersion())),
+	)
+}
+
+// logger returns the Logger of the Device with the id attached to every record
+func (d *Device) logger() *slog.Logger {
+	if d.Logger == nil {
+		return discardLogger
+	}
+	return d.Logger.With(slog.String("device", d.DeviceID))
+}
+
+// logFrame logs the header of a sent or received frame and, at debug level, its decrypted json payload
+func (d *Device) logFrame(msg string, frame parser.Message, length int) {
+	logger := d.logger()
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Uint64("sequence", uint64(frame.SequenceNr)),
+		slog.String("command", frame.Command.String()),
+		slog.Int("length", length),
+	}
+	if frame.HasReturnCode {
+		attrs = append(attrs, slog.Uint64("return_code", uint64(frame.ReturnCode)))
+	}
+	// The payloads of the session key negotiation are binary and derived from the local key
+	if len(frame.Payload) > 0 && json.Valid(frame.Payload) {
+		attrs = append(attrs, slog.String("payload", d.redact(frame.Payload)))
+	}
+	logger.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// redact removes the local key from the payload
+func (d *Device) redact(payload []byte) string {
+	if len(d.Key) == 0 {
+		return string(payload)
+	}
+	return string(bytes.ReplaceAll(payload, d.Key, []byte(redacted)))
+}
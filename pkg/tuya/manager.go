@@ -0,0 +1,194 @@
+package tuya
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultMaxConcurrentConnects of a Manager
+const defaultMaxConcurrentConnects = 4
+
+// Manager keeps the connections to a set of devices open.
+// Lost connections are re-established, while the number of simultaneous connection attempts is limited
+type Manager struct {
+	// Reconnect configures the backoff between the connection attempts of a Device.
+	// If the policy gives up, the Device stays managed but disconnected
+	Reconnect *ReconnectPolicy
+	// mutex guards the devices
+	mutex   sync.Mutex
+	devices map[string]*managedDevice
+	closed  bool
+	// connectSlots limits the simultaneous connection attempts
+	connectSlots chan struct{}
+}
+
+// managedDevice is a Device kept connected by its supervisor
+type managedDevice struct {
+	device *Device
+	// stop the supervisor
+	stop context.CancelFunc
+	// done is closed when the supervisor stopped
+	done chan struct{}
+}
+
+// CreateManager for devices which are connected at most maxConcurrentConnects at a time.
+// A value of 0 or less uses the default of 4
+func CreateManager(maxConcurrentConnects int) *Manager {
+	if maxConcurrentConnects <= 0 {
+		maxConcurrentConnects = defaultMaxConcurrentConnects
+	}
+	return &Manager{
+		Reconnect: &ReconnectPolicy{
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+			Jitter:         0.2,
+		},
+		devices:      map[string]*managedDevice{},
+		connectSlots: make(chan struct{}, maxConcurrentConnects),
+	}
+}
+
+// Add the Device and connect to it in the background.
+// The Manager takes care of reconnecting, so the Reconnect policy of the Device is removed
+func (m *Manager) Add(device *Device) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	if _, ok := m.devices[device.DeviceID]; ok {
+		return ErrDeviceExists
+	}
+
+	device.mutex.Lock()
+	device.Reconnect = nil
+	device.mutex.Unlock()
+
+	ctx, stop := context.WithCancel(context.Background())
+	managed := &managedDevice{
+		device: device,
+		stop:   stop,
+		done:   make(chan struct{}),
+	}
+	m.devices[device.DeviceID] = managed
+	go m.supervise(ctx, managed)
+	return nil
+}
+
+// Remove the Device and disconnect from it
+func (m *Manager) Remove(deviceId string) error {
+	m.mutex.Lock()
+	managed, ok := m.devices[deviceId]
+	delete(m.devices, deviceId)
+	m.mutex.Unlock()
+	if !ok {
+		return ErrDeviceNotManaged
+	}
+
+	managed.stop()
+	<-managed.done
+	return nil
+}
+
+// Get the managed Device by its id
+func (m *Manager) Get(deviceId string) (*Device, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	managed, ok := m.devices[deviceId]
+	if !ok {
+		return nil, false
+	}
+	return managed.device, true
+}
+
+// Devices returns every managed Device
+func (m *Manager) Devices() []*Device {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	devices := make([]*Device, 0, len(m.devices))
+	for _, managed := range m.devices {
+		devices = append(devices, managed.device)
+	}
+	return devices
+}
+
+// Close disconnects from every Device and waits until all connection attempts stopped or the context is done.
+// The Manager can't be used afterward
+func (m *Manager) Close(ctx context.Context) error {
+	m.mutex.Lock()
+	m.closed = true
+	devices := m.devices
+	m.devices = map[string]*managedDevice{}
+	m.mutex.Unlock()
+
+	for _, managed := range devices {
+		managed.stop()
+	}
+	for _, managed := range devices {
+		select {
+		case <-managed.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// supervise keeps the Device connected until the context is done
+func (m *Manager) supervise(ctx context.Context, managed *managedDevice) {
+	defer close(managed.done)
+	defer managed.device.Disconnect()
+
+	policy := m.Reconnect
+	attempt := 0
+	for {
+		err := m.connect(ctx, managed.device)
+		if err == nil {
+			attempt = 0
+			select {
+			case <-managed.device.connectionClosed():
+				err = ErrConnectionClosed
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if policy != nil && policy.MaxAttempts > 0 && attempt+1 >= policy.MaxAttempts {
+			if policy.OnGiveUp != nil {
+				policy.OnGiveUp(err)
+			}
+			return
+		}
+		var backoff time.Duration
+		if policy != nil {
+			backoff = policy.backoff(attempt)
+		}
+		attempt++
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// connect to the Device as soon as a connection attempt is allowed
+func (m *Manager) connect(ctx context.Context, device *Device) error {
+	select {
+	case m.connectSlots <- struct{}{}:
+		defer func() { <-m.connectSlots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reconnectAttemptTimeout)
+	defer cancel()
+	return device.ConnectContext(ctx)
+}
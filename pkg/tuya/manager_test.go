@@ -0,0 +1,209 @@
+package tuya_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// connectionObserver counts the connections of a Device
+type connectionObserver struct {
+	mutex      sync.Mutex
+	connects   int
+	reconnects int
+	failed     int
+	lost       int
+}
+
+func (o *connectionObserver) Connected(deviceId string, reconnect bool, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err != nil {
+		o.failed++
+		return
+	}
+	o.connects++
+	if reconnect {
+		o.reconnects++
+	}
+}
+
+func (o *connectionObserver) ConnectionLost(deviceId string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.lost++
+}
+
+func (o *connectionObserver) RequestDone(deviceId string, command string, latency time.Duration, err error) {
+}
+
+// counts returns the successful connects, the reconnects among them and the lost connections
+func (o *connectionObserver) counts() (connects, reconnects, lost int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.connects, o.reconnects, o.lost
+}
+
+// failures returns the failed connection attempts
+func (o *connectionObserver) failures() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.failed
+}
+
+// waitFor polls the condition until it is met and fails the test if that takes too long
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// createManager returns a Manager reconnecting quickly which is closed when the test ends
+func createManager(t *testing.T, maxConcurrentConnects int) *tuya.Manager {
+	manager := tuya.CreateManager(maxConcurrentConnects)
+	manager.Reconnect = &tuya.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	t.Cleanup(func() { manager.Close(context.Background()) })
+	return manager
+}
+
+func TestManager(t *testing.T) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_3, map[string]interface{}{"1": true})
+	manager := createManager(t, 0)
+
+	device := server.Device()
+	device.Reconnect = tuya.DefaultReconnectPolicy()
+	if err := manager.Add(device); err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+	if device.Reconnect != nil {
+		t.Error("the Reconnect policy of the Device hasn't been removed")
+	}
+	if err := manager.Add(server.Device()); !errors.Is(err, tuya.ErrDeviceExists) {
+		t.Errorf("adding the device twice returned %v", err)
+	}
+	waitFor(t, "the connection", device.IsConnected)
+
+	if managed, ok := manager.Get(tuyatest.DeviceID); !ok || managed != device {
+		t.Errorf("Get returned %v, %t", managed, ok)
+	}
+	if devices := manager.Devices(); len(devices) != 1 || devices[0] != device {
+		t.Errorf("Devices returned %v", devices)
+	}
+	if _, ok := manager.Get("unknown"); ok {
+		t.Error("Get found an unknown device")
+	}
+
+	if err := manager.Remove(tuyatest.DeviceID); err != nil {
+		t.Fatalf("removing failed: %v", err)
+	}
+	if device.IsConnected() {
+		t.Error("the removed device is still connected")
+	}
+	if _, ok := manager.Get(tuyatest.DeviceID); ok {
+		t.Error("the removed device is still managed")
+	}
+	if err := manager.Remove(tuyatest.DeviceID); !errors.Is(err, tuya.ErrDeviceNotManaged) {
+		t.Errorf("removing the device twice returned %v", err)
+	}
+}
+
+// startDevices starts fake devices with distinct ids
+func startDevices(t *testing.T, count int, version tuya.Version) ([]*tuyatest.Server, []*tuya.Device) {
+	var servers []*tuyatest.Server
+	var devices []*tuya.Device
+	for i := range count {
+		deviceId := tuyatest.DeviceID[:len(tuyatest.DeviceID)-1] + strconv.Itoa(i)
+		server := tuyatest.StartServer(t, deviceId, version, map[string]interface{}{"1": true})
+		servers = append(servers, server)
+		devices = append(devices, server.Device())
+	}
+	return servers, devices
+}
+
+func TestManagerClose(t *testing.T) {
+	_, devices := startDevices(t, 3, tuya.Version_3_3)
+	manager := createManager(t, 0)
+	for _, device := range devices {
+		if err := manager.Add(device); err != nil {
+			t.Fatalf("adding failed: %v", err)
+		}
+	}
+	for _, device := range devices {
+		waitFor(t, "the connection", device.IsConnected)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.Close(ctx); err != nil {
+		t.Fatalf("closing failed: %v", err)
+	}
+	for _, device := range devices {
+		if device.IsConnected() {
+			t.Errorf("%s is still connected after Close", device.DeviceID)
+		}
+	}
+	if managed := manager.Devices(); len(managed) != 0 {
+		t.Errorf("devices are still managed after Close: %v", managed)
+	}
+	if err := manager.Add(devices[0]); !errors.Is(err, tuya.ErrManagerClosed) {
+		t.Errorf("adding after Close returned %v", err)
+	}
+}
+
+// TestManagerLimitsConnects checks that no more than maxConcurrentConnects session keys are negotiated at a time
+func TestManagerLimitsConnects(t *testing.T) {
+	const handshake = 200 * time.Millisecond
+	servers, devices := startDevices(t, 4, tuya.Version_3_4)
+	for _, server := range servers {
+		server.Inject(tuyatest.Fault{Command: tuyatest.SessionKeyStart, Delay: handshake})
+	}
+	manager := createManager(t, 2)
+
+	start := time.Now()
+	for _, device := range devices {
+		if err := manager.Add(device); err != nil {
+			t.Fatalf("adding failed: %v", err)
+		}
+	}
+	for _, device := range devices {
+		waitFor(t, "the connection", device.IsConnected)
+	}
+	// Two rounds of two handshakes each
+	if elapsed := time.Since(start); elapsed < 2*handshake {
+		t.Errorf("4 devices connected within %s, so more than 2 connected at a time", elapsed)
+	}
+}
+
+func TestManagerReconnects(t *testing.T) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_5, map[string]interface{}{"1": true})
+	manager := createManager(t, 0)
+	observer := &connectionObserver{}
+	device := server.Device()
+	device.Observer = observer
+	if err := manager.Add(device); err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+	waitFor(t, "the connection", device.IsConnected)
+
+	for round := 1; round <= 2; round++ {
+		server.DropConnections()
+		waitFor(t, "the reconnect", func() bool {
+			_, reconnects, lost := observer.counts()
+			return lost == round && reconnects == round && device.IsConnected()
+		})
+		if _, err := device.FetchStatus(); err != nil {
+			t.Errorf("fetching the status after the reconnect failed: %v", err)
+		}
+	}
+}
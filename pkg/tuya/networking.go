@@ -1,32 +1,203 @@
 package tuya
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Binozo/GoTuya/internal/commands"
 	"github.com/Binozo/GoTuya/internal/parser"
+	"io"
+	"log/slog"
 	"net"
+	"slices"
+	"sort"
+	"strconv"
 	"time"
 )
 
-const port = 6668
-const headerSize = 24
+// defaultPort the devices listen on
+const defaultPort = 6668
+
+// defaultDpsToRequest are queried from DeviceType_22 devices until their dps have been detected.
+// Every device has at least the first dps
+var defaultDpsToRequest = []int{1}
+
+// errDataUnvalid is returned by parseResponse if the Device didn't understand the query.
+// This happens if a DeviceType_22 device is queried with DP_QUERY
+var errDataUnvalid = errors.New("the device rejected the query: json obj data unvalid")
 
 // Connect to the specified tuya device
 // Automatically fetches current status
 func (d *Device) Connect() error {
-	connection, err := net.Dial("tcp", fmt.Sprintf("%s:%d", d.IP, port))
+	return d.ConnectContext(context.Background())
+}
+
+// ConnectContext connects to the specified tuya device like Connect.
+// The context bounds dialing, the session key negotiation and fetching the current status
+func (d *Device) ConnectContext(ctx context.Context) error {
+	// The connection isn't closed by the last user of Acquire anymore
+	d.usersMutex.Lock()
+	d.temporary = false
+	d.usersMutex.Unlock()
+	return d.connectContext(ctx)
+}
+
+func (d *Device) connectContext(ctx context.Context) error {
+	d.mutex.Lock()
+	d.stopReconnecting()
+	d.mutex.Unlock()
+	return d.connect(ctx)
+}
+
+// connect establishes the connection and fetches the current status.
+// The connection is closed again if anything fails
+func (d *Device) connect(ctx context.Context) error {
+	d.connectMutex.Lock()
+	defer d.connectMutex.Unlock()
+
+	d.mutex.Lock()
+	reconnect := d.lost
+	// Don't leak a previous connection
+	d.disconnect()
+	d.mutex.Unlock()
+
+	if d.ProtocolVersion() == Version_Auto {
+		d.detectsVersion = true
+	}
+	var err error
+	if d.detectsVersion {
+		err = d.connectDetectingVersion(ctx)
+	} else {
+		var connection net.Conn
+		if connection, err = d.dial(ctx); err != nil {
+			err = contextError(ctx, err)
+		} else {
+			err = d.open(ctx, connection)
+		}
+	}
 	if err != nil {
+		d.logger().Warn("connecting failed", slog.Any("error", err))
+	} else {
+		d.mutex.Lock()
+		d.lost = false
+		d.mutex.Unlock()
+	}
+	if d.Observer != nil {
+		d.Observer.Connected(d.DeviceID, reconnect, err)
+	}
+	return err
+}
+
+// open the session on the dialed connection and fetch the current status.
+// The connection is closed again if anything fails
+func (d *Device) open(ctx context.Context, connection net.Conn) error {
+	reader := parser.NewFrameReader(connection)
+	// The session key is negotiated without holding the mutex, so the Device stays responsive during the handshake
+	d.mutex.Lock()
+	d.opening = connection
+	d.mutex.Unlock()
+
+	var sessionKey []byte
+	var err error
+	if d.ProtocolVersion().negotiatesSessionKey() {
+		sessionKey, err = d.negotiateSessionKey(ctx, connection, reader)
+	}
+
+	d.mutex.Lock()
+	aborted := d.opening != connection
+	d.opening = nil
+	if err != nil || aborted {
+		d.mutex.Unlock()
+		connection.Close()
+		if err == nil {
+			err = ErrConnectionClosed
+		}
 		return err
 	}
-	d.conn = &connection
+	d.conn = connection
+	d.reader = reader
+	d.sessionKey = sessionKey
 
-	_, err = d.sendRefreshCommand()
-	return err
+	// From now on every frame is read by the read loop
+	d.closed = make(chan struct{})
+	go d.readLoop(connection, reader, d.encryptionKey(), d.closed)
+	d.mutex.Unlock()
+
+	if _, err = d.sendRefreshCommand(ctx, d.requestedDps()); err != nil {
+		d.mutex.Lock()
+		if d.isConnected() && d.conn == connection {
+			d.disconnect()
+		}
+		d.mutex.Unlock()
+		return err
+	}
+
+	// DeviceType_22 devices only report the requested dps, so they have to be found out once
+	if d.deviceType() == DeviceType_22 && slices.Equal(d.requestedDps(), defaultDpsToRequest) {
+		if dpsToRequest, err := d.DetectDpsContext(ctx); err != nil {
+			d.logger().Warn("detecting the dps failed", slog.Any("error", err))
+		} else {
+			d.logger().Debug("detected dps", slog.Any("dps", dpsToRequest))
+		}
+	}
+
+	if d.HeartbeatInterval > 0 {
+		d.mutex.Lock()
+		if d.isConnected() && d.conn == connection {
+			d.stopHeartbeat = make(chan struct{})
+			go d.heartbeatLoop(connection, d.HeartbeatInterval, d.stopHeartbeat)
+		}
+		d.mutex.Unlock()
+	}
+	d.logger().Info("connected", slog.String("address", connection.RemoteAddr().String()), slog.String("version", string(d.ProtocolVersion())))
+	return nil
+}
+
+// dial opens the connection to the Device.
+// The IP of devices created by CreateDeviceByID is resolved again if the Device can't be reached
+func (d *Device) dial(ctx context.Context) (net.Conn, error) {
+	dialer := d.dialer()
+	if !d.resolvesIP {
+		return dialer.DialContext(ctx, "tcp", d.address(d.Address()))
+	}
+
+	ip := d.Address()
+	if ip == "" {
+		var err error
+		if ip, err = d.resolve(ctx); err != nil {
+			return nil, err
+		}
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, resolvedDialTimeout)
+	connection, err := dialer.DialContext(dialCtx, "tcp", d.address(ip))
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return connection, err
+	}
+
+	// The Device may have got a new IP
+	newIP, resolveErr := d.resolve(ctx)
+	if resolveErr != nil || newIP == ip {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, "tcp", d.address(newIP))
+}
+
+// dialer returns the configured Dialer or the default one
+func (d *Device) dialer() Dialer {
+	if d.Dialer != nil {
+		return d.Dialer
+	}
+	return &net.Dialer{}
+}
+
+// address returns the host and port to dial
+func (d *Device) address(ip string) string {
+	port := d.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
 }
 
 // Set a dps value and send it to the tuya Device.
@@ -38,6 +209,16 @@ func (d *Device) Connect() error {
 //	    "1": true, // Power on
 //	})
 func (d *Device) Set(dps map[string]interface{}) error {
+	return d.SetContext(context.Background(), dps)
+}
+
+// SetContext sets the dps values like Set.
+// Returns the error of the context if it is done before the Device answered
+func (d *Device) SetContext(ctx context.Context, dps map[string]interface{}) error {
+	dps, err := d.Schema.encode(dps)
+	if err != nil {
+		return err
+	}
 	setPayload := payload{
 		deviceId: d.DeviceID,
 		t:        time.Now(),
@@ -45,43 +226,67 @@ func (d *Device) Set(dps map[string]interface{}) error {
 		dpId:     nil,
 	}
 
-	commandByte := commands.CONTROL
-	sequenceNr := d.currentSequenceNr + 1
-
-	if !d.IsConnected() {
-		return errors.New("there is no active connection")
-	}
-	connection := *d.conn
-
-	encoded, err := setPayload.encode(d.Key, commandByte, sequenceNr)
-	if err != nil {
-		return err
-	}
-
-	_, err = connection.Write(encoded)
-	if err != nil {
-		return err
-	}
-
-	setResponse, err := d.readFullPayload()
+	commandByte := d.controlCommand()
+	setResponse, err := d.request(ctx, setPayload, commandByte, []commands.Type{commandByte})
 	if err != nil {
 		return err
 	}
 
 	if setResponse.commandByte != commandByte {
-		return errors.New("the device didn't answer to the command properly")
+		return &UnexpectedCommandError{Expected: int(commandByte), Received: int(setResponse.commandByte)}
 	}
 	return nil
 }
 
 // GetCurrentStatus returns the current last given status from the Device without connecting
+// The status is kept up to date with the status updates pushed by the Device while connected
 func (d *Device) GetCurrentStatus() map[string]interface{} {
-	return d.currentStatus.dps
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	return copyDps(d.currentStatus.dps)
+}
+
+// GetCurrentDPs returns the current last given status like GetCurrentStatus with typed values
+func (d *Device) GetCurrentDPs() map[string]DPValue {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	return d.Schema.decode(d.currentStatus.dps)
+}
+
+// GetDP returns the last given value of the dps without connecting
+func (d *Device) GetDP(index string) (DPValue, error) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	value, ok := d.currentStatus.dps[index]
+	if !ok {
+		return DPValue{}, fmt.Errorf("%w: dps index %s not contained in: %v", ErrDpsNotReported, index, d.currentStatus.dps)
+	}
+	return d.Schema.decodeValue(index, value)
+}
+
+// SetDPs sets the typed dps values like Set
+func (d *Device) SetDPs(dps map[string]DPValue) error {
+	return d.SetDPsContext(context.Background(), dps)
+}
+
+// SetDPsContext sets the typed dps values like SetContext
+func (d *Device) SetDPsContext(ctx context.Context, dps map[string]DPValue) error {
+	values := make(map[string]interface{}, len(dps))
+	for index, value := range dps {
+		values[index] = value
+	}
+	return d.SetContext(ctx, values)
 }
 
 // FetchStatus connects to the Device and returns the current status
 func (d *Device) FetchStatus() (map[string]interface{}, error) {
-	curResponse, err := d.sendRefreshCommand()
+	return d.FetchStatusContext(context.Background())
+}
+
+// FetchStatusContext returns the current status like FetchStatus.
+// Returns the error of the context if it is done before the Device answered
+func (d *Device) FetchStatusContext(ctx context.Context) (map[string]interface{}, error) {
+	curResponse, err := d.sendRefreshCommand(ctx, d.requestedDps())
 	if err != nil {
 		return nil, err
 	}
@@ -89,195 +294,338 @@ func (d *Device) FetchStatus() (map[string]interface{}, error) {
 	return curResponse.dps, nil
 }
 
-// sendRefreshCommand refreshes the Device status
-func (d *Device) sendRefreshCommand() (response, error) {
-	if !d.IsConnected() {
-		return response{}, errors.New("there is no active connection")
-	}
-	connection := *d.conn
-	commandByte := commands.DP_REFRESH
-	if d.Version == Version_3_4 {
-		commandByte = commands.DP_QUERY_NEW
+// DetectDps finds out which dps the Device supports and remembers them in DpsToRequest.
+// This is required for DeviceType_22 devices because they only report the requested dps
+func (d *Device) DetectDps() ([]int, error) {
+	return d.DetectDpsContext(context.Background())
+}
+
+// DetectDpsContext finds out the supported dps like DetectDps.
+// Returns the error of the context if it is done before the Device answered
+func (d *Device) DetectDpsContext(ctx context.Context) ([]int, error) {
+	found := map[int]bool{}
+	collect := func(dps map[string]interface{}) {
+		for key := range dps {
+			if dpsId, err := strconv.Atoi(key); err == nil {
+				found[dpsId] = true
+			}
+		}
 	}
 
-	refreshPayload := payload{
-		deviceId: d.DeviceID,
-		t:        time.Now(),
-		dpId:     []int{4, 5, 6, 18, 19, 20},
+	if d.deviceType() != DeviceType_22 {
+		dps, err := d.FetchStatusContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		collect(dps)
+	} else {
+		// Requesting too many dps at once is rejected, so we probe them in ranges.
+		// Information has been taken from: https://github.com/jasonacox/tinytuya/blob/master/tinytuya/core/XenonDevice.py
+		ranges := [][2]int{{1, 11}, {11, 21}, {21, 31}, {100, 111}}
+		for _, dpsRange := range ranges {
+			var dpsToRequest []int
+			for dpsId := dpsRange[0]; dpsId < dpsRange[1]; dpsId++ {
+				dpsToRequest = append(dpsToRequest, dpsId)
+			}
+			curResponse, err := d.sendRefreshCommand(ctx, dpsToRequest)
+			if errors.Is(err, errDataUnvalid) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			collect(curResponse.dps)
+		}
 	}
 
-	d.currentSequenceNr = 1 // always starts with 1
-	encodedPayload, err := refreshPayload.encode(d.Key, commandByte, d.currentSequenceNr)
-	if err != nil {
-		return response{}, err
+	if len(found) == 0 {
+		return nil, ErrNoDps
+	}
+	dpsToRequest := make([]int, 0, len(found))
+	for dpsId := range found {
+		dpsToRequest = append(dpsToRequest, dpsId)
 	}
+	sort.Ints(dpsToRequest)
 
-	wroteLen, err := connection.Write(encodedPayload)
-	if err != nil {
-		return response{}, err
+	d.typeMutex.Lock()
+	d.DpsToRequest = dpsToRequest
+	d.typeMutex.Unlock()
+	return slices.Clone(dpsToRequest), nil
+}
+
+// sendRefreshCommand refreshes the Device status
+func (d *Device) sendRefreshCommand(ctx context.Context, dpsToRequest []int) (response, error) {
+	deviceType := d.deviceType()
+	curResponse, err := d.sendQuery(ctx, deviceType, dpsToRequest)
+	if errors.Is(err, errDataUnvalid) && deviceType != DeviceType_22 {
+		// The device wants to be queried differently
+		d.typeMutex.Lock()
+		d.DeviceType = DeviceType_22
+		d.typeMutex.Unlock()
+		return d.sendQuery(ctx, DeviceType_22, dpsToRequest)
 	}
-	if wroteLen != len(encodedPayload) {
-		return response{}, errors.New("tuya device didn't read data")
+	return curResponse, err
+}
+
+// sendQuery sends the query matching the DeviceType and waits for its answer.
+// The dpsToRequest are only queried from DeviceType_22 devices
+func (d *Device) sendQuery(ctx context.Context, deviceType DeviceType, dpsToRequest []int) (response, error) {
+	// Devices using protocol 3.1 and device22 devices only know about the query
+	if d.ProtocolVersion() != Version_3_1 && deviceType != DeviceType_22 {
+		refreshPayload := payload{
+			deviceId: d.DeviceID,
+			t:        time.Now(),
+			dpId:     []int{4, 5, 6, 18, 19, 20},
+		}
+		// The Device doesn't always answer the refresh, so we don't wait for it
+		if err := d.send(ctx, refreshPayload, commands.DP_REFRESH); err != nil {
+			return response{}, err
+		}
 	}
 
-	d.currentSequenceNr += 1
-	commandByte = commands.DP_QUERY
+	commandByte := d.queryCommand(deviceType)
+	answerCommands := []commands.Type{commandByte}
 	queryPayload := payload{
 		deviceId: d.DeviceID,
 		t:        time.Now(),
-		dps:      map[string]interface{}{},
 	}
-	encodedPayload, err = queryPayload.encode(d.Key, commandByte, d.currentSequenceNr)
-	if err != nil {
-		return response{}, err
+	if deviceType == DeviceType_22 {
+		// The requested dps are listed with null values
+		queryPayload.dps = map[string]interface{}{}
+		for _, dpsId := range dpsToRequest {
+			queryPayload.dps[strconv.Itoa(dpsId)] = nil
+		}
+		// device22 devices may answer with a status update
+		answerCommands = append(answerCommands, commands.STATUS)
+	} else if !d.ProtocolVersion().negotiatesSessionKey() {
+		queryPayload.dps = map[string]interface{}{}
 	}
 
-	wroteLen, err = connection.Write(encodedPayload)
+	curResponse, err := d.request(ctx, queryPayload, commandByte, answerCommands)
 	if err != nil {
 		return response{}, err
 	}
-	if wroteLen != len(encodedPayload) {
-		return response{}, errors.New("tuya device didn't read data")
-	}
 
-	curResponse, err := d.readFullPayload()
+	// DeviceType_22 devices only report the requested dps, so the known ones are kept
+	d.statusMutex.Lock()
+	knownDps := d.currentStatus.dps
+	if knownDps == nil {
+		knownDps = map[string]interface{}{}
+	}
+	for key, value := range curResponse.dps {
+		knownDps[key] = value
+	}
 	d.currentStatus = curResponse
-	return curResponse, err
+	d.currentStatus.dps = knownDps
+	d.statusMutex.Unlock()
+	return curResponse, nil
 }
 
-// IsConnected returns if the device is connected
+// deviceType returns the DeviceType which may be switched while querying
+func (d *Device) deviceType() DeviceType {
+	d.typeMutex.Lock()
+	defer d.typeMutex.Unlock()
+	return d.DeviceType
+}
+
+// requestedDps returns a copy of the DpsToRequest which may be replaced by DetectDps
+func (d *Device) requestedDps() []int {
+	d.typeMutex.Lock()
+	defer d.typeMutex.Unlock()
+	return slices.Clone(d.DpsToRequest)
+}
+
+// IsConnected returns if the device is connected.
+// The connection is dropped automatically if the Device stops answering heartbeats
 func (d *Device) IsConnected() bool {
-	return d.conn != nil
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.isConnected()
 }
 
-// Disconnect any connection to the Device
+// Disconnect any connection to the Device and stop reconnecting
 func (d *Device) Disconnect() {
-	if d.IsConnected() {
-		connection := *d.conn
-		connection.Close()
+	d.mutex.Lock()
+	d.stopReconnecting()
+	d.mutex.Unlock()
+
+	// Abort a running session key negotiation and wait for a running reconnect attempt
+	d.mutex.Lock()
+	if d.opening != nil {
+		d.opening.Close()
+		d.opening = nil
+	}
+	d.mutex.Unlock()
+	d.connectMutex.Lock()
+	defer d.connectMutex.Unlock()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lost = false
+	d.disconnect()
+}
+
+// connectionClosed returns a channel which is closed once the current connection is closed
+func (d *Device) connectionClosed() <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed == nil {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return d.closed
+}
+
+func (d *Device) isConnected() bool {
+	return d.conn != nil
+}
+
+func (d *Device) disconnect() {
+	if d.isConnected() {
+		d.logger().Info("disconnected")
+		if d.stopHeartbeat != nil {
+			close(d.stopHeartbeat)
+			d.stopHeartbeat = nil
+		}
+		d.conn.Close()
 		d.conn = nil
+		d.reader = nil
+		d.sessionKey = nil
+		d.closed = nil
 	}
 }
 
-// readFullPayload reads the Device's response to our request
-func (d *Device) readFullPayload() (response, error) {
-	// We need the first 24 bytes
-	// It consists of: prefix (4), sequence (4), command (4), length (4),
-	// CRC (4), and suffix (4) for 24 total bytes
-	// Information has been taken from: https://github.com/codetheweb/tuyapi/blob/d88fd6c84b228b42f0b6aedd84f0ac3cdb1a5523/lib/message-parser.js#L102
+// controlCommand returns the command used to set dps values
+func (d *Device) controlCommand() commands.Type {
+	if d.ProtocolVersion().negotiatesSessionKey() {
+		return commands.CONTROL_NEW
+	}
+	return commands.CONTROL
+}
 
-	if !d.IsConnected() {
-		return response{}, errors.New("there is no active connection")
+// queryCommand returns the command used to query the dps values
+func (d *Device) queryCommand(deviceType DeviceType) commands.Type {
+	if d.ProtocolVersion().negotiatesSessionKey() {
+		return commands.DP_QUERY_NEW
 	}
+	if deviceType == DeviceType_22 {
+		return commands.CONTROL_NEW
+	}
+	return commands.DP_QUERY
+}
 
-	connection := *d.conn
-	headerBuffer := make([]byte, headerSize)
-	read, err := connection.Read(headerBuffer)
-	if err != nil {
-		return response{}, err
+// encryptionKey returns the negotiated session key if there is one
+func (d *Device) encryptionKey() []byte {
+	if d.sessionKey != nil {
+		return d.sessionKey
 	}
-	if read < 24 {
-		return response{}, errors.New(fmt.Sprintf("tuya packet is too short. Length: %d", read))
+	return d.Key
+}
+
+// nextSequenceNr returns a new sequence number to correlate the request with its answer
+func (d *Device) nextSequenceNr() uint32 {
+	sequenceNr := d.sequenceNr.Add(1)
+	if sequenceNr == 0 {
+		// 0 is used by the Device for unsolicited frames
+		sequenceNr = d.sequenceNr.Add(1)
 	}
+	return sequenceNr
+}
+
+// send the payload without waiting for an answer
+func (d *Device) send(ctx context.Context, p payload, command commands.Type) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	// Now validate the header
-	if binary.BigEndian.Uint32(headerBuffer[0:4]) != 0x000055AA {
-		return response{}, errors.New(fmt.Sprintf("prefix does not match: 0x%02x", headerBuffer[0:4]))
+	if !d.isConnected() {
+		return ErrNotConnected
 	}
+	return d.writePayload(ctx, p, command, d.nextSequenceNr())
+}
 
-	packetPayloadSize := binary.BigEndian.Uint32(headerBuffer[12:16])
-	totalPayloadLength := packetPayloadSize + 16 - headerSize
-	// Now we read the remaining data
-	packetPayload := make([]byte, totalPayloadLength)
-	read, err = connection.Read(packetPayload)
+// writePayload encodes and sends the payload to the Device
+func (d *Device) writePayload(ctx context.Context, p payload, command commands.Type, sequenceNr uint32) error {
+	jsonBuffer, err := p.exportJson(d.ProtocolVersion(), command)
 	if err != nil {
-		return response{}, err
-	}
-	if uint32(read) != totalPayloadLength {
-		return response{}, errors.New(fmt.Sprintf("mismatch between expected packet size (%d) and actual read size: %d", totalPayloadLength, read))
+		return err
 	}
-	totalPayload := append(headerBuffer, packetPayload...)
+	return d.writeMessage(ctx, parser.Message{
+		SequenceNr: sequenceNr,
+		Command:    command,
+		Payload:    jsonBuffer,
+	})
+}
 
-	if uint32(len(totalPayload)-8) < packetPayloadSize {
-		return response{}, errors.New(fmt.Sprintf("packet missing payload (has length: %d)", packetPayloadSize))
+// writeMessage encodes and sends the raw message to the Device
+func (d *Device) writeMessage(ctx context.Context, msg parser.Message) error {
+	if !d.isConnected() {
+		return ErrNotConnected
 	}
+	return d.writeFrame(ctx, d.conn, d.encryptionKey(), msg)
+}
 
-	// Check for any additional data
-	suffixLocation := bytes.Index(totalPayload, []byte{0x00, 0x00, 0xAA, 0x55})
-	if suffixLocation != len(totalPayload)-4 {
-		// TODO: not really sure when this happens and what to do with it
-		// Take a look: https://github.com/codetheweb/tuyapi/blob/d88fd6c84b228b42f0b6aedd84f0ac3cdb1a5523/lib/message-parser.js#L121
-		return response{}, errors.New("this shouldn't happen. please file an issue")
+// writeFrame encodes the message with the key and sends it on the connection
+func (d *Device) writeFrame(ctx context.Context, connection net.Conn, key []byte, msg parser.Message) error {
+	encoded, err := parser.EncodeMessage(msg, string(d.ProtocolVersion()), key)
+	if err != nil {
+		return err
 	}
 
-	newSequenceNr := binary.BigEndian.Uint32(totalPayload[4:8])
-	commandByte := binary.BigEndian.Uint32(totalPayload[8:12])
-	// TODO: implement: https://github.com/codetheweb/tuyapi/blob/d88fd6c84b228b42f0b6aedd84f0ac3cdb1a5523/lib/message-parser.js#L147
+	release := bindDeadline(ctx, connection.SetWriteDeadline)
+	wroteLen, err := connection.Write(encoded)
+	release()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if wroteLen != len(encoded) {
+		return io.ErrShortWrite
+	}
+	d.logFrame("sent frame", msg, len(encoded))
+	return nil
+}
 
-	returnCode := binary.BigEndian.Uint32(totalPayload[16:20])
-	dataPayload := totalPayload[headerSize-4 : headerSize+packetPayloadSize-16]
-	if returnCode&0xFFFFFF00 != 0 {
-		// TODO this line below needs to be tested. Probably appears in UDP broadcasts
-		// https://github.com/codetheweb/tuyapi/blob/d88fd6c84b228b42f0b6aedd84f0ac3cdb1a5523/lib/message-parser.js#L161
-		dataPayload = totalPayload[headerSize-8 : headerSize-8+packetPayloadSize-8]
+// readFrame reads and decodes the next frame sent by the Device.
+// Only used before the read loop has been started
+func (d *Device) readFrame(reader *parser.FrameReader, key []byte) (parser.Message, error) {
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		return parser.Message{}, err
 	}
+	return d.decodeMessage(frame, key, false)
+}
 
-	// Now we parse the payload
-	if (d.Version == Version_3_3 || d.Version == Version_3_2) && bytes.Equal(dataPayload[0:3], []byte("3.3")) {
-		// Remove 3.3/3.2 header
-		dataPayload = dataPayload[15:]
-	} else if d.Version != Version_3_3 && d.Version != Version_3_2 {
-		// base64 encoded
-		dataPayload, err = base64.StdEncoding.DecodeString(string(dataPayload[19:]))
-		if err != nil {
-			return response{}, err
+// bindDeadline applies the deadline and the cancellation of the context to the connection.
+// The returned function has to be called to release the connection again
+func bindDeadline(ctx context.Context, setDeadline func(time.Time) error) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		setDeadline(deadline)
+	}
+	expired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		// Unblocks any pending operation
+		setDeadline(time.Unix(1, 0))
+		close(expired)
+	})
+	return func() {
+		if !stop() {
+			// The deadline must not be set after it has been cleared
+			<-expired
 		}
+		setDeadline(time.Time{})
 	}
+}
 
-	if len(dataPayload) == 0 {
-		return response{
-			payload: payload{
-				deviceId: d.DeviceID,
-				t:        time.Now(),
-				dps:      nil,
-				dpId:     nil,
-			},
-			returnCode:    int(returnCode),
-			commandByte:   commands.Type(commandByte),
-			newSequenceNr: int(newSequenceNr),
-		}, err
+// contextError replaces the error caused by the context or the deadline of the connection with the error of the context.
+// The deadline of the connection may expire slightly before the context is marked as done
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
 	}
-
-	decrypted, err := parser.DecryptAESWithECB(dataPayload, d.Key)
-	if err != nil {
-		return response{}, err
+	if deadline, ok := ctx.Deadline(); errors.Is(ctx.Err(), context.DeadlineExceeded) || ok && !time.Now().Before(deadline) {
+		return fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded)
 	}
-	var jsonResponse map[string]interface{}
-	// TODO: need to find out where code above goes wrong that len(decrypted)-3 is needed or overall what is happening here
-	if bytes.Equal(decrypted[len(decrypted)-3:], []byte{0x03, 0x03, 0x03}) {
-		decrypted = decrypted[:len(decrypted)-3]
-	} else if bytes.Equal(decrypted[len(decrypted)-2:], []byte{0x02, 0x02}) {
-		decrypted = decrypted[:len(decrypted)-2]
-	} else if bytes.Equal(decrypted[len(decrypted)-1:], []byte{0x01}) {
-		decrypted = decrypted[:len(decrypted)-1]
-	} else if bytes.Equal(decrypted[len(decrypted)-8:], []byte{0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08}) {
-		decrypted = decrypted[:len(decrypted)-8]
-	} else if bytes.Equal(decrypted[len(decrypted)-16:], []byte{0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10}) {
-		decrypted = decrypted[:len(decrypted)-16]
-	}
-	if err = json.Unmarshal(decrypted, &jsonResponse); err != nil {
-		return response{}, err
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-
-	return response{
-		payload: payload{
-			deviceId: jsonResponse["devId"].(string),
-			t:        time.Now(),
-			dps:      jsonResponse["dps"].(map[string]interface{}),
-			dpId:     nil,
-		},
-		returnCode:    int(returnCode),
-		commandByte:   commands.Type(commandByte),
-		newSequenceNr: int(newSequenceNr),
-	}, nil
+	return err
 }
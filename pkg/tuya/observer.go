@@ -0,0 +1,16 @@
+package tuya
+
+import "time"
+
+// Observer is notified about the traffic of a Device, e.g. to collect metrics.
+// It is called synchronously, so it has to return quickly and must not use the Device
+type Observer interface {
+	// Connected is called after every connection attempt with its error.
+	// reconnect is set if the attempt re-establishes a lost connection
+	Connected(deviceId string, reconnect bool, err error)
+	// ConnectionLost is called if the Device dropped the connection or stopped answering
+	ConnectionLost(deviceId string)
+	// RequestDone is called once a request has been answered or failed.
+	// The command is the name of the sent command, e.g. CONTROL or DP_QUERY
+	RequestDone(deviceId string, command string, latency time.Duration, err error)
+}
@@ -0,0 +1,120 @@
+package tuya
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/commands"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+)
+
+// readLoop reads every frame sent by the Device until the connection is closed.
+// Status updates are published to the subscribers, answers are dispatched to the pending requests
+func (d *Device) readLoop(connection net.Conn, reader *parser.FrameReader, key []byte, closed chan<- struct{}) {
+	defer func() {
+		close(closed)
+		d.connectionLost(connection)
+	}()
+
+	// The negotiated session key proves that the local key is right
+	keyProven := d.ProtocolVersion().negotiatesSessionKey()
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		var curResponse response
+		msg, err := d.decodeMessage(frame, key, keyProven)
+		if err == nil {
+			curResponse, err = d.parseResponse(msg)
+		}
+		if err == nil && curResponse.commandByte == commands.STATUS {
+			d.publishStatus(curResponse)
+		}
+		d.dispatch(msg, readResult{response: curResponse, err: err})
+	}
+}
+
+// decodeMessage decodes the frame sent by the Device.
+// Unless the key has been proven by the session key negotiation, errors caused by a wrong key are marked with ErrWrongKey.
+// The tcp checksum makes corrupted frames unlikely
+func (d *Device) decodeMessage(frame []byte, key []byte, keyProven bool) (parser.Message, error) {
+	msg, err := parser.DecodeMessage(frame, string(d.ProtocolVersion()), key, true)
+	if !keyProven && (errors.Is(err, ErrDecryptionFailed) || errors.Is(err, ErrHmacMismatch) || errors.Is(err, ErrSignatureMismatch)) {
+		err = fmt.Errorf("%w: %w", ErrWrongKey, err)
+	}
+	if err != nil {
+		d.logger().Warn("couldn't decode frame", slog.Int("length", len(frame)), slog.Any("error", err))
+		return msg, err
+	}
+	d.logFrame("received frame", msg, len(frame))
+	return msg, nil
+}
+
+// parseResponse parses the json payload of the decoded frame
+func (d *Device) parseResponse(msg parser.Message) (response, error) {
+	curResponse := response{
+		payload: payload{
+			deviceId: d.DeviceID,
+			t:        time.Now(),
+			dps:      nil,
+			dpId:     nil,
+		},
+		returnCode:    int(msg.ReturnCode),
+		commandByte:   msg.Command,
+		newSequenceNr: int(msg.SequenceNr),
+	}
+	if bytes.Contains(msg.Payload, []byte("data unvalid")) {
+		return response{}, errDataUnvalid
+	}
+	if msg.ReturnCode != 0 {
+		return response{}, &DeviceError{
+			ReturnCode: int(msg.ReturnCode),
+			Message:    string(bytes.TrimSpace(msg.Payload)),
+		}
+	}
+	if len(msg.Payload) == 0 {
+		return curResponse, nil
+	}
+
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(msg.Payload, &jsonResponse); err != nil {
+		if version := d.ProtocolVersion(); version != Version_3_1 && !version.negotiatesSessionKey() {
+			// A wrong key may produce a valid padding by chance, but no valid json
+			return response{}, fmt.Errorf("%w: %w", ErrWrongKey, err)
+		}
+		return response{}, err
+	}
+
+	if deviceId, ok := jsonResponse["devId"].(string); ok {
+		curResponse.deviceId = deviceId
+	}
+	curResponse.dps, _ = jsonResponse["dps"].(map[string]interface{})
+	// Since protocol 3.4 the dps are wrapped in a data object
+	if data, ok := jsonResponse["data"].(map[string]interface{}); ok && curResponse.dps == nil {
+		curResponse.dps, _ = data["dps"].(map[string]interface{})
+	}
+	if t, ok := parseTimestamp(jsonResponse["t"]); ok {
+		curResponse.t = t
+	}
+	return curResponse, nil
+}
+
+// parseTimestamp parses the unix timestamp sent by the Device either as number or as string
+func parseTimestamp(value interface{}) (time.Time, bool) {
+	switch t := value.(type) {
+	case float64:
+		return time.Unix(int64(t), 0), true
+	case string:
+		if seconds, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return time.Unix(seconds, 0), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,39 @@
+package tuya_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// TestCorruptFrameAfterHandshake checks that corrupted frames aren't blamed on the key once it has been proven
+func TestCorruptFrameAfterHandshake(t *testing.T) {
+	tests := []struct {
+		version tuya.Version
+		want    error
+	}{
+		{tuya.Version_3_3, tuya.ErrCrcMismatch},
+		{tuya.Version_3_4, tuya.ErrHmacMismatch},
+		{tuya.Version_3_5, tuya.ErrDecryptionFailed},
+	}
+	for _, test := range tests {
+		t.Run(string(test.version), func(t *testing.T) {
+			server := tuyatest.StartServer(t, tuyatest.DeviceID, test.version, map[string]interface{}{"1": false})
+			device := server.Connect(t)
+			server.Inject(
+				tuyatest.Fault{Command: tuyatest.Control, CorruptChecksum: true},
+				tuyatest.Fault{Command: tuyatest.ControlNew, CorruptChecksum: true},
+			)
+
+			err := device.Set(map[string]interface{}{"1": true})
+			if !errors.Is(err, test.want) {
+				t.Errorf("expected %v, got %v", test.want, err)
+			}
+			if errors.Is(err, tuya.ErrWrongKey) {
+				t.Errorf("the corrupted frame has been blamed on the key: %v", err)
+			}
+		})
+	}
+}
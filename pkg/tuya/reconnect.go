@@ -0,0 +1,140 @@
+package tuya
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// reconnectAttemptTimeout bounds a single attempt to re-establish the connection
+const reconnectAttemptTimeout = 10 * time.Second
+
+// ReconnectPolicy configures how a lost connection is re-established.
+// Requests which were in flight when the connection was lost fail and are never sent again,
+// so a Set is never applied twice
+type ReconnectPolicy struct {
+	// MaxAttempts until giving up. Set to 0 to retry forever
+	MaxAttempts int
+	// InitialBackoff before the first attempt. It is doubled after every failed attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff between two attempts
+	MaxBackoff time.Duration
+	// Jitter randomizes every backoff by up to the given fraction (0 to 1),
+	// so devices dropped at the same time don't reconnect at the same time
+	Jitter float64
+	// OnGiveUp is called with the last error once MaxAttempts have failed
+	OnGiveUp func(err error)
+}
+
+// DefaultReconnectPolicy retries 10 times with a backoff between 1 and 30 seconds
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Jitter:         0.2,
+	}
+}
+
+// backoff returns how long to wait before the given attempt (starting at 0)
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 0; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		backoff += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(backoff))
+	}
+	if backoff < 0 {
+		return 0
+	}
+	return backoff
+}
+
+// connectionLost closes the connection if it is still the active one.
+// A reconnect is started if the Device has a ReconnectPolicy
+func (d *Device) connectionLost(connection net.Conn) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.isConnected() || d.conn != connection {
+		return
+	}
+	d.logger().Warn("connection lost")
+	d.lost = true
+	d.disconnect()
+	if d.Observer != nil {
+		d.Observer.ConnectionLost(d.DeviceID)
+	}
+
+	if d.Reconnect != nil && d.stopReconnect == nil {
+		d.stopReconnect = make(chan struct{})
+		go d.reconnectLoop(*d.Reconnect, d.stopReconnect)
+	}
+}
+
+// reconnectLoop tries to connect again until it succeeds, the policy gives up or stop is closed
+func (d *Device) reconnectLoop(policy ReconnectPolicy, stop chan struct{}) {
+	var err error
+	for attempt := 0; policy.MaxAttempts <= 0 || attempt < policy.MaxAttempts; attempt++ {
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		d.logger().Info("reconnecting", slog.Int("attempt", attempt+1))
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectAttemptTimeout)
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err = d.connect(ctx)
+		cancel()
+
+		d.mutex.Lock()
+		if err == nil && d.isConnected() {
+			// A connection lost from now on starts a new reconnect
+			if d.stopReconnect == stop {
+				d.stopReconnect = nil
+			}
+			d.mutex.Unlock()
+			return
+		}
+		d.mutex.Unlock()
+		if err == nil {
+			err = ErrConnectionClosed
+		}
+	}
+
+	d.mutex.Lock()
+	stopped := d.stopReconnect != stop
+	if !stopped {
+		d.stopReconnect = nil
+	}
+	d.mutex.Unlock()
+	if stopped {
+		return
+	}
+	d.logger().Error("gave up reconnecting", slog.Any("error", err))
+	if policy.OnGiveUp != nil {
+		policy.OnGiveUp(err)
+	}
+}
+
+// stopReconnecting stops a running reconnect. Requires the mutex
+func (d *Device) stopReconnecting() {
+	if d.stopReconnect != nil {
+		close(d.stopReconnect)
+		d.stopReconnect = nil
+	}
+}
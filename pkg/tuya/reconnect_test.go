@@ -0,0 +1,98 @@
+package tuya_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// connectReconnecting connects to the fake device with the policy and observes the connections
+func connectReconnecting(t *testing.T, server *tuyatest.Server, policy *tuya.ReconnectPolicy) (*tuya.Device, *connectionObserver) {
+	observer := &connectionObserver{}
+	device := server.Device()
+	device.Reconnect = policy
+	device.Observer = observer
+	if err := device.Connect(); err != nil {
+		t.Fatalf("connecting failed: %v", err)
+	}
+	t.Cleanup(device.Disconnect)
+	return device, observer
+}
+
+func TestReconnect(t *testing.T) {
+	for _, version := range tuyatest.Versions {
+		t.Run(string(version), func(t *testing.T) {
+			server := tuyatest.StartServer(t, tuyatest.DeviceID, version, map[string]interface{}{"1": true})
+			device, observer := connectReconnecting(t, server, &tuya.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond})
+
+			server.DropConnections()
+			waitFor(t, "the reconnect", func() bool {
+				_, reconnects, lost := observer.counts()
+				return lost == 1 && reconnects == 1 && device.IsConnected()
+			})
+			if _, err := device.FetchStatus(); err != nil {
+				t.Errorf("fetching the status after the reconnect failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_3, map[string]interface{}{"1": true})
+	gaveUp := make(chan error, 1)
+	device, observer := connectReconnecting(t, server, &tuya.ReconnectPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		OnGiveUp:       func(err error) { gaveUp <- err },
+	})
+
+	// The device is gone, so every attempt fails
+	server.Close()
+	select {
+	case err := <-gaveUp:
+		if err == nil {
+			t.Error("OnGiveUp has been called without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reconnect didn't give up")
+	}
+	if failures := observer.failures(); failures != 3 {
+		t.Errorf("expected 3 failed attempts, got %d", failures)
+	}
+	if device.IsConnected() {
+		t.Error("connected although every attempt failed")
+	}
+}
+
+func TestDisconnectStopsReconnect(t *testing.T) {
+	const backoff = 200 * time.Millisecond
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_5, map[string]interface{}{"1": true})
+	gaveUp := make(chan error, 1)
+	device, observer := connectReconnecting(t, server, &tuya.ReconnectPolicy{
+		InitialBackoff: backoff,
+		OnGiveUp:       func(err error) { gaveUp <- err },
+	})
+
+	server.DropConnections()
+	waitFor(t, "the lost connection", func() bool {
+		_, _, lost := observer.counts()
+		return lost == 1
+	})
+	device.Disconnect()
+
+	time.Sleep(2 * backoff)
+	if connects, _, _ := observer.counts(); connects != 1 || device.IsConnected() {
+		t.Errorf("reconnected after Disconnect (%d connects)", connects)
+	}
+	select {
+	case err := <-gaveUp:
+		t.Errorf("OnGiveUp has been called after Disconnect: %v", err)
+	default:
+	}
+	// A stopped reconnect doesn't keep the Device from connecting again
+	if err := device.Connect(); err != nil {
+		t.Errorf("connecting after Disconnect failed: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tuya
+
+import (
+	"context"
+	"errors"
+	"github.com/Binozo/GoTuya/internal/commands"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"net"
+	"slices"
+	"time"
+)
+
+// readResult is a frame forwarded by the read loop
+type readResult struct {
+	response response
+	err      error
+}
+
+// pendingRequest waits for the answer to a sent request
+type pendingRequest struct {
+	// answerCommands the answer may be sent with
+	answerCommands []commands.Type
+	result         chan readResult
+}
+
+// request sends the payload and waits for the answer until the context is done.
+// Answers are matched by their sequence number and, if the Device doesn't echo it, by their command
+func (d *Device) request(ctx context.Context, p payload, command commands.Type, answerCommands []commands.Type) (response, error) {
+	start := time.Now()
+	curResponse, err := d.exchange(ctx, p, command, answerCommands)
+	if d.Observer != nil {
+		d.Observer.RequestDone(d.DeviceID, command.String(), time.Since(start), err)
+	}
+	return curResponse, err
+}
+
+// exchange sends the payload and waits for the answer
+func (d *Device) exchange(ctx context.Context, p payload, command commands.Type, answerCommands []commands.Type) (response, error) {
+	pending := &pendingRequest{
+		answerCommands: answerCommands,
+		result:         make(chan readResult, 1),
+	}
+
+	d.mutex.Lock()
+	if !d.isConnected() {
+		d.mutex.Unlock()
+		return response{}, ErrNotConnected
+	}
+	closed := d.closed
+	connection := d.conn
+	sequenceNr := d.nextSequenceNr()
+	d.addPending(sequenceNr, pending)
+	defer d.removePending(sequenceNr)
+	err := d.writePayload(ctx, p, command, sequenceNr)
+	d.mutex.Unlock()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && !netErr.Timeout() {
+			// The connection is broken
+			d.connectionLost(connection)
+		}
+		return response{}, err
+	}
+
+	select {
+	case result := <-pending.result:
+		return result.response, result.err
+	case <-closed:
+		return response{}, ErrConnectionClosed
+	case <-ctx.Done():
+		return response{}, contextError(ctx, ctx.Err())
+	}
+}
+
+func (d *Device) addPending(sequenceNr uint32, pending *pendingRequest) {
+	d.pendingMutex.Lock()
+	defer d.pendingMutex.Unlock()
+	if d.pending == nil {
+		d.pending = map[uint32]*pendingRequest{}
+	}
+	d.pending[sequenceNr] = pending
+}
+
+func (d *Device) removePending(sequenceNr uint32) {
+	d.pendingMutex.Lock()
+	defer d.pendingMutex.Unlock()
+	delete(d.pending, sequenceNr)
+}
+
+// dispatch hands the received frame to the request waiting for it.
+// Frames nobody is waiting for are dropped
+func (d *Device) dispatch(msg parser.Message, result readResult) {
+	d.pendingMutex.Lock()
+	defer d.pendingMutex.Unlock()
+
+	// Status updates are only an answer if the request explicitly waits for them
+	if pending, ok := d.pending[msg.SequenceNr]; ok && (msg.Command != commands.STATUS || slices.Contains(pending.answerCommands, msg.Command)) {
+		d.deliver(msg.SequenceNr, pending, result)
+		return
+	}
+	// Answers with an unknown sequence number are late answers to requests which already gave up waiting.
+	// They must not be mistaken for the answer of the next request
+	if msg.Command == commands.STATUS || msg.SequenceNr != 0 {
+		return
+	}
+
+	// Not every Device echoes the sequence number, so we fall back to the oldest request waiting for this command
+	var oldestSequenceNr uint32
+	var oldest *pendingRequest
+	for sequenceNr, pending := range d.pending {
+		if slices.Contains(pending.answerCommands, msg.Command) && (oldest == nil || sequenceNr < oldestSequenceNr) {
+			oldestSequenceNr = sequenceNr
+			oldest = pending
+		}
+	}
+	if oldest != nil {
+		d.deliver(oldestSequenceNr, oldest, result)
+	}
+}
+
+// deliver the result to the pending request. Requires the pendingMutex
+func (d *Device) deliver(sequenceNr uint32, pending *pendingRequest, result readResult) {
+	delete(d.pending, sequenceNr)
+	pending.result <- result
+}
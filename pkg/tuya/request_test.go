@@ -0,0 +1,41 @@
+package tuya_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// TestLateAnswerIsDropped checks that the late answer to a timed out request isn't mistaken for the answer of the next one
+func TestLateAnswerIsDropped(t *testing.T) {
+	for _, version := range tuyatest.Versions {
+		t.Run(string(version), func(t *testing.T) {
+			server := tuyatest.StartServer(t, tuyatest.DeviceID, version, map[string]interface{}{"2": 20})
+			device := server.Connect(t)
+			// The first answer arrives after its request timed out while the second request is waiting
+			for _, command := range []tuyatest.Command{tuyatest.Control, tuyatest.ControlNew} {
+				server.Inject(
+					tuyatest.Fault{Command: command, Delay: 300 * time.Millisecond},
+					tuyatest.Fault{Command: command, Delay: 200 * time.Millisecond},
+				)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := device.SetContext(ctx, map[string]interface{}{"2": 25}); !errors.Is(err, tuya.ErrTimeout) {
+				t.Fatalf("expected the first request to time out, got %v", err)
+			}
+
+			if err := device.Set(map[string]interface{}{"2": 30}); err != nil {
+				t.Fatalf("setting failed: %v", err)
+			}
+			if dps := server.Dps(); dps["2"] != float64(30) {
+				t.Errorf("Set returned before the device applied the dps: %v", dps)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package tuya
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// resolveTimeout bounds waiting for the broadcast of a Device. Devices broadcast every few seconds
+const resolveTimeout = 15 * time.Second
+
+// resolvedDialTimeout bounds dialing a resolved IP, so a stale IP is noticed quickly
+const resolvedDialTimeout = 5 * time.Second
+
+// announcement is the last broadcast received from a Device
+type announcement struct {
+	device DiscoveredDevice
+	time   time.Time
+}
+
+// announcedMutex guards the announced broadcasts
+var announcedMutex sync.Mutex
+
+// announced caches the last broadcast of every Device received by the shared listener
+var announced = map[string]announcement{}
+
+// announcedChanged is closed and replaced whenever a broadcast has been received
+var announcedChanged = make(chan struct{})
+
+// announce remembers the broadcast of the Device and wakes up everybody waiting for a broadcast
+func announce(device DiscoveredDevice) {
+	announcedMutex.Lock()
+	defer announcedMutex.Unlock()
+	announced[device.DeviceID] = announcement{device: device, time: time.Now()}
+	close(announcedChanged)
+	announcedChanged = make(chan struct{})
+}
+
+// lastAnnouncement returns the last broadcast received from the Device
+func lastAnnouncement(deviceId string) (announcement, bool) {
+	announcedMutex.Lock()
+	defer announcedMutex.Unlock()
+	last, ok := announced[deviceId]
+	return last, ok
+}
+
+// announcementsSince returns the devices which broadcast since the given time
+// and a channel which is closed once the next broadcast has been received
+func announcementsSince(since time.Time) ([]DiscoveredDevice, <-chan struct{}) {
+	announcedMutex.Lock()
+	defer announcedMutex.Unlock()
+	var devices []DiscoveredDevice
+	for _, last := range announced {
+		if !last.time.Before(since) {
+			devices = append(devices, last.device)
+		}
+	}
+	return devices, announcedChanged
+}
+
+// Address returns the IP the Device is currently reached at.
+// The IP of devices created by CreateDeviceByID is resolved from the discovery broadcasts
+func (d *Device) Address() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.IP
+}
+
+// resolve waits for the broadcast of the Device and remembers the announced IP
+func (d *Device) resolve(ctx context.Context) (string, error) {
+	ip, err := resolveIP(ctx, d.DeviceID)
+	if err != nil {
+		return "", err
+	}
+
+	d.mutex.Lock()
+	d.IP = ip
+	d.mutex.Unlock()
+	d.logger().Info("resolved ip", slog.String("ip", ip))
+	return ip, nil
+}
+
+// resolveIP waits for a broadcast of the Device sent from now on
+func resolveIP(ctx context.Context, deviceId string) (string, error) {
+	since := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	release, err := listenForBroadcasts()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	for {
+		devices, changed := announcementsSince(since)
+		for _, device := range devices {
+			if device.DeviceID == deviceId {
+				return device.IP, nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %s: %w", ErrDeviceNotFound, deviceId, ctx.Err())
+		}
+	}
+}
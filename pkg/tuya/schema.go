@@ -0,0 +1,375 @@
+package tuya
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DPSchema describes the values a single dps accepts, as published by tuya for every product
+type DPSchema struct {
+	// Code names the dps, e.g. temp_set
+	Code string
+	// Kind of the values
+	Kind DPKind
+	// ReadOnly dps are only reported by the Device and can't be set
+	ReadOnly bool
+	// Unit of DPInteger values, e.g. ℃
+	Unit string
+	// Min, Max and Step bound the raw DPInteger values
+	Min  int64
+	Max  int64
+	Step int64
+	// Scale of DPInteger values. The actual value is the raw value divided by 10^Scale
+	Scale int
+	// Range of the DPEnum values
+	Range []string
+	// Labels of the DPBitmap flags. The first label is the lowest bit
+	Labels []string
+	// MaxLen of DPString and DPRaw values in bytes. Unlimited if 0
+	MaxLen int
+}
+
+// Schema of the dps of a product by dps index
+type Schema map[string]DPSchema
+
+// schemaFunction is a single dps of the specification exported by the tuya developer platform
+type schemaFunction struct {
+	Code   string          `json:"code"`
+	DpID   int             `json:"dp_id"`
+	Type   string          `json:"type"`
+	Values json.RawMessage `json:"values"`
+}
+
+// schemaValues are the constraints of a dps. Exported as json object or as string containing it
+type schemaValues struct {
+	Unit   string      `json:"unit"`
+	Min    json.Number `json:"min"`
+	Max    json.Number `json:"max"`
+	Step   json.Number `json:"step"`
+	Scale  json.Number `json:"scale"`
+	Range  []string    `json:"range"`
+	Label  []string    `json:"label"`
+	MaxLen json.Number `json:"maxlen"`
+}
+
+// specification exported by the tuya developer platform. Functions can be set, status is only reported
+type specification struct {
+	Functions []schemaFunction `json:"functions"`
+	Status    []schemaFunction `json:"status"`
+}
+
+// ParseSchema parses the specification of a product as exported by the tuya developer platform
+// (GET /v1.0/devices/{device_id}/specifications, with or without the result envelope)
+// or the mapping of a device as stored by tinytuya in devices.json
+func ParseSchema(data []byte) (Schema, error) {
+	var envelope struct {
+		Result *specification `json:"result"`
+		specification
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	spec := envelope.specification
+	if envelope.Result != nil {
+		spec = *envelope.Result
+	}
+	if len(spec.Functions) > 0 || len(spec.Status) > 0 {
+		return parseSpecification(spec)
+	}
+	return parseMapping(data)
+}
+
+func parseSpecification(spec specification) (Schema, error) {
+	schema := Schema{}
+	for _, function := range spec.Status {
+		dps, err := parseDPSchema(function.Code, function.Type, function.Values)
+		if err != nil {
+			return nil, err
+		}
+		dps.ReadOnly = true
+		schema[strconv.Itoa(function.DpID)] = dps
+	}
+	for _, function := range spec.Functions {
+		dps, err := parseDPSchema(function.Code, function.Type, function.Values)
+		if err != nil {
+			return nil, err
+		}
+		schema[strconv.Itoa(function.DpID)] = dps
+	}
+	return schema, nil
+}
+
+// parseMapping parses the dps of a device by index like tinytuya stores them
+func parseMapping(data []byte) (Schema, error) {
+	var mapping map[string]schemaFunction
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	schema := Schema{}
+	for index, function := range mapping {
+		if _, err := strconv.Atoi(index); err != nil {
+			return nil, fmt.Errorf("%w: %q isn't a dps index", ErrInvalidSchema, index)
+		}
+		dps, err := parseDPSchema(function.Code, function.Type, function.Values)
+		if err != nil {
+			return nil, err
+		}
+		schema[index] = dps
+	}
+	return schema, nil
+}
+
+func parseDPSchema(code string, kind string, rawValues json.RawMessage) (DPSchema, error) {
+	dps := DPSchema{Code: code}
+	switch strings.ToLower(kind) {
+	case "boolean", "bool":
+		dps.Kind = DPBool
+	case "integer", "value":
+		dps.Kind = DPInteger
+	case "enum":
+		dps.Kind = DPEnum
+	case "string", "json":
+		dps.Kind = DPString
+	case "raw":
+		dps.Kind = DPRaw
+	case "bitmap":
+		dps.Kind = DPBitmap
+	default:
+		return DPSchema{}, fmt.Errorf("%w: %s has the unknown type %q", ErrInvalidSchema, code, kind)
+	}
+
+	// The developer platform exports the values as json string
+	var encoded string
+	if err := json.Unmarshal(rawValues, &encoded); err == nil {
+		rawValues = json.RawMessage(encoded)
+	}
+	var values schemaValues
+	if len(rawValues) > 0 {
+		if err := json.Unmarshal(rawValues, &values); err != nil {
+			return DPSchema{}, fmt.Errorf("%w: values of %s: %w", ErrInvalidSchema, code, err)
+		}
+	}
+
+	var err error
+	integer := func(number json.Number) int64 {
+		if number == "" || err != nil {
+			return 0
+		}
+		var parsed int64
+		parsed, err = number.Int64()
+		return parsed
+	}
+	dps.Unit = values.Unit
+	dps.Min = integer(values.Min)
+	dps.Max = integer(values.Max)
+	dps.Step = integer(values.Step)
+	dps.Scale = int(integer(values.Scale))
+	dps.MaxLen = int(integer(values.MaxLen))
+	dps.Range = values.Range
+	dps.Labels = values.Label
+	if err != nil {
+		return DPSchema{}, fmt.Errorf("%w: values of %s: %w", ErrInvalidSchema, code, err)
+	}
+	if err = dps.checkScale(); err != nil {
+		return DPSchema{}, err
+	}
+	return dps, nil
+}
+
+// Decode the value reported by the Device into its Kind. DPInteger values are scaled
+func (s DPSchema) Decode(value interface{}) (DPValue, error) {
+	converted, err := DPValueOf(value)
+	if err != nil {
+		return DPValue{}, err
+	}
+
+	switch s.Kind {
+	case DPBool:
+		boolean, err := converted.Bool()
+		return BoolDP(boolean), err
+	case DPInteger:
+		if err = s.checkScale(); err != nil {
+			return DPValue{}, err
+		}
+		raw, err := converted.Int()
+		return ScaledDP(raw, s.Scale), err
+	case DPEnum:
+		enum, err := converted.Enum()
+		return EnumDP(enum), err
+	case DPString:
+		text, err := converted.Text()
+		return StringDP(text), err
+	case DPRaw:
+		raw, err := converted.Raw()
+		return RawDP(raw), err
+	case DPBitmap:
+		bitmap, err := converted.Bitmap()
+		return BitmapDP(bitmap), err
+	}
+	return converted, nil
+}
+
+// Encode validates the value and returns it as sent to the Device. DPInteger values are scaled
+func (s DPSchema) Encode(value DPValue) (interface{}, error) {
+	if s.ReadOnly {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnlyDps, s.Code)
+	}
+
+	switch s.Kind {
+	case DPBool:
+		return value.Bool()
+	case DPInteger:
+		raw, err := s.scale(value)
+		if err != nil {
+			return nil, err
+		}
+		if s.Min != 0 || s.Max != 0 {
+			if raw < s.Min || raw > s.Max {
+				return nil, s.invalidValue("%s is out of the range %s to %s", value, ScaledDP(s.Min, s.Scale), ScaledDP(s.Max, s.Scale))
+			}
+		}
+		if s.Step > 1 && (raw-s.Min)%s.Step != 0 {
+			return nil, s.invalidValue("%s isn't a multiple of the step %s", value, ScaledDP(s.Step, s.Scale))
+		}
+		return raw, nil
+	case DPEnum:
+		enum, err := value.Enum()
+		if err != nil {
+			return nil, err
+		}
+		if len(s.Range) > 0 && !slices.Contains(s.Range, enum) {
+			return nil, s.invalidValue("%q isn't one of %v", enum, s.Range)
+		}
+		return enum, nil
+	case DPString:
+		text, err := value.Text()
+		if err != nil {
+			return nil, err
+		}
+		if s.MaxLen > 0 && len(text) > s.MaxLen {
+			return nil, s.invalidValue("%d bytes exceed the maximum length %d", len(text), s.MaxLen)
+		}
+		return text, nil
+	case DPRaw:
+		raw, err := value.Raw()
+		if err != nil {
+			return nil, err
+		}
+		if s.MaxLen > 0 && len(raw) > s.MaxLen {
+			return nil, s.invalidValue("%d bytes exceed the maximum length %d", len(raw), s.MaxLen)
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case DPBitmap:
+		bitmap, err := value.Bitmap()
+		if err != nil {
+			return nil, err
+		}
+		if len(s.Labels) > 0 && len(s.Labels) < 64 && bitmap >= 1<<len(s.Labels) {
+			return nil, s.invalidValue("%#b sets more than the %d flags", bitmap, len(s.Labels))
+		}
+		return bitmap, nil
+	}
+	return value.jsonValue()
+}
+
+// scale returns the raw integer of the actual value
+func (s DPSchema) scale(value DPValue) (int64, error) {
+	if err := s.checkScale(); err != nil {
+		return 0, err
+	}
+	if s.Scale == 0 {
+		return value.Int()
+	}
+	number, err := value.Float()
+	if err != nil {
+		return 0, err
+	}
+	scaled := math.Round(number * math.Pow10(s.Scale))
+	if math.Abs(scaled) >= math.MaxInt64 {
+		return 0, s.invalidValue("%s is too large", value)
+	}
+	return int64(scaled), nil
+}
+
+// checkScale returns ErrInvalidSchema if the Scale is out of 0 to 18
+func (s DPSchema) checkScale() error {
+	if !validScale(s.Scale) {
+		return fmt.Errorf("%w: %s has the invalid scale %d", ErrInvalidSchema, s.Code, s.Scale)
+	}
+	return nil
+}
+
+func (s DPSchema) invalidValue(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidValue, s.Code, fmt.Sprintf(format, args...))
+}
+
+// Flags returns the labels of the flags set in the DPBitmap value
+func (s DPSchema) Flags(value DPValue) ([]string, error) {
+	bitmap, err := value.Bitmap()
+	if err != nil {
+		return nil, err
+	}
+	var flags []string
+	for bit, label := range s.Labels {
+		if bit < 64 && bitmap&(1<<bit) != 0 {
+			flags = append(flags, label)
+		}
+	}
+	return flags, nil
+}
+
+// decode the reported dps. Values which don't match their schema are kept like DPValueOf converts them.
+// Values which can't be converted at all, e.g. null, are skipped
+func (s Schema) decode(dps map[string]interface{}) map[string]DPValue {
+	values := make(map[string]DPValue, len(dps))
+	for index, value := range dps {
+		if converted, err := s.decodeValue(index, value); err == nil {
+			values[index] = converted
+		}
+	}
+	return values
+}
+
+// decodeValue decodes the value with the schema of the dps if there is one
+func (s Schema) decodeValue(index string, value interface{}) (DPValue, error) {
+	if dps, ok := s[index]; ok {
+		if decoded, err := dps.Decode(value); err == nil {
+			return decoded, nil
+		}
+	}
+	return DPValueOf(value)
+}
+
+// encode validates the dps to set. Dps without a schema are sent unchecked
+func (s Schema) encode(dps map[string]interface{}) (map[string]interface{}, error) {
+	encoded := make(map[string]interface{}, len(dps))
+	for index, value := range dps {
+		dpsSchema, ok := s[index]
+		if !ok {
+			if typed, isTyped := value.(DPValue); isTyped {
+				jsonValue, err := typed.jsonValue()
+				if err != nil {
+					return nil, fmt.Errorf("dps index %s: %w", index, err)
+				}
+				value = jsonValue
+			}
+			encoded[index] = value
+			continue
+		}
+
+		typed, err := DPValueOf(value)
+		if err == nil {
+			value, err = dpsSchema.Encode(typed)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dps index %s: %w", index, err)
+		}
+		encoded[index] = value
+	}
+	return encoded, nil
+}
@@ -0,0 +1,171 @@
+package tuya_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// specification as exported by the tuya developer platform, with the values as json string
+const specification = `{
+	"category": "kt",
+	"functions": [
+		{"code": "switch", "dp_id": 1, "type": "Boolean", "values": "{}"},
+		{"code": "temp_set", "dp_id": 2, "type": "Integer", "values": "{\"unit\":\"℃\",\"min\":160,\"max\":300,\"scale\":1,\"step\":5}"},
+		{"code": "mode", "dp_id": 4, "type": "Enum", "values": "{\"range\":[\"cold\",\"hot\",\"wind\"]}"}
+	],
+	"status": [
+		{"code": "temp_current", "dp_id": 3, "type": "Integer", "values": "{\"unit\":\"℃\",\"min\":-200,\"max\":1000,\"scale\":1,\"step\":1}"}
+	]
+}`
+
+// mapping of the same device as stored by tinytuya in devices.json
+const mapping = `{
+	"1": {"code": "switch", "type": "Boolean", "values": {}},
+	"2": {"code": "temp_set", "type": "Integer", "values": {"unit": "℃", "min": 160, "max": 300, "scale": 1, "step": 5}},
+	"4": {"code": "mode", "type": "Enum", "values": {"range": ["cold", "hot", "wind"]}}
+}`
+
+var (
+	switchSchema      = tuya.DPSchema{Code: "switch", Kind: tuya.DPBool}
+	tempSetSchema     = tuya.DPSchema{Code: "temp_set", Kind: tuya.DPInteger, Unit: "℃", Min: 160, Max: 300, Step: 5, Scale: 1}
+	modeSchema        = tuya.DPSchema{Code: "mode", Kind: tuya.DPEnum, Range: []string{"cold", "hot", "wind"}}
+	tempCurrentSchema = tuya.DPSchema{Code: "temp_current", Kind: tuya.DPInteger, ReadOnly: true, Unit: "℃", Min: -200, Max: 1000, Step: 1, Scale: 1}
+)
+
+func TestParseSchema(t *testing.T) {
+	withoutStatus := tuya.Schema{"1": switchSchema, "2": tempSetSchema, "4": modeSchema}
+	withStatus := tuya.Schema{"1": switchSchema, "2": tempSetSchema, "3": tempCurrentSchema, "4": modeSchema}
+
+	tests := []struct {
+		name string
+		data string
+		want tuya.Schema
+	}{
+		{"specification", specification, withStatus},
+		{"specification with result envelope", `{"result": ` + specification + `, "success": true}`, withStatus},
+		{"tinytuya mapping", mapping, withoutStatus},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := tuya.ParseSchema([]byte(test.data))
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+			if !reflect.DeepEqual(schema, test.want) {
+				t.Errorf("got  %+v\nwant %+v", schema, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSchemaInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no json", `switch`},
+		{"unknown type", `{"1": {"code": "switch", "type": "Complex"}}`},
+		{"no dps index", `{"switch": {"code": "switch", "type": "Boolean"}}`},
+		{"fractional min", `{"2": {"code": "temp_set", "type": "Integer", "values": {"min": 1.5}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := tuya.ParseSchema([]byte(test.data)); !errors.Is(err, tuya.ErrInvalidSchema) {
+				t.Errorf("expected ErrInvalidSchema, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSchemaEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  tuya.DPSchema
+		value   tuya.DPValue
+		want    interface{}
+		wantErr error
+	}{
+		{"bool", switchSchema, tuya.BoolDP(true), true, nil},
+		{"scaled integer", tempSetSchema, tuya.ScaledDP(215, 1), int64(215), nil},
+		{"integer at min", tempSetSchema, tuya.IntegerDP(16), int64(160), nil},
+		{"integer at max", tempSetSchema, tuya.IntegerDP(30), int64(300), nil},
+		{"integer below min", tempSetSchema, tuya.ScaledDP(155, 1), nil, tuya.ErrInvalidValue},
+		{"integer above max", tempSetSchema, tuya.ScaledDP(305, 1), nil, tuya.ErrInvalidValue},
+		{"integer off step", tempSetSchema, tuya.ScaledDP(212, 1), nil, tuya.ErrInvalidValue},
+		{"enum in range", modeSchema, tuya.EnumDP("hot"), "hot", nil},
+		{"enum out of range", modeSchema, tuya.EnumDP("dry"), nil, tuya.ErrInvalidValue},
+		{"read-only", tempCurrentSchema, tuya.ScaledDP(215, 1), nil, tuya.ErrReadOnlyDps},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := test.schema.Encode(test.value)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("expected %v, got %v (%v)", test.wantErr, err, encoded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			if encoded != test.want {
+				t.Errorf("got %#v, want %#v", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestSchemaInvalidScale(t *testing.T) {
+	schema := tuya.DPSchema{Code: "temp_set", Kind: tuya.DPInteger, Scale: 64}
+	if _, err := schema.Decode(215); !errors.Is(err, tuya.ErrInvalidSchema) {
+		t.Errorf("Decode returned %v instead of ErrInvalidSchema", err)
+	}
+	if _, err := schema.Encode(tuya.IntegerDP(21)); !errors.Is(err, tuya.ErrInvalidSchema) {
+		t.Errorf("Encode returned %v instead of ErrInvalidSchema", err)
+	}
+	if _, err := tuya.ParseSchema([]byte(`{"2": {"code": "temp_set", "type": "Integer", "values": {"scale": 19}}}`)); !errors.Is(err, tuya.ErrInvalidSchema) {
+		t.Errorf("ParseSchema returned %v instead of ErrInvalidSchema", err)
+	}
+}
+
+func TestScaledReadsAndWrites(t *testing.T) {
+	server := tuyatest.StartServer(t, tuyatest.DeviceID, tuya.Version_3_3, map[string]interface{}{
+		"1": false,
+		"2": 215,
+		"3": 198,
+		"4": "cold",
+	})
+	device := server.Connect(t)
+	schema, err := tuya.ParseSchema([]byte(specification))
+	if err != nil {
+		t.Fatalf("parsing the schema failed: %v", err)
+	}
+	device.Schema = schema
+
+	for index, want := range map[string]float64{"2": 21.5, "3": 19.8} {
+		value, err := device.GetDP(index)
+		if err != nil {
+			t.Fatalf("reading dps %s failed: %v", index, err)
+		}
+		if number, err := value.Float(); err != nil || number != want {
+			t.Errorf("dps %s = %s, %v, want %v", index, value, err, want)
+		}
+	}
+
+	if err := device.Set(map[string]interface{}{"2": 24.5}); err != nil {
+		t.Fatalf("setting failed: %v", err)
+	}
+	if dps := server.Dps(); dps["2"] != float64(245) {
+		t.Errorf("the raw value hasn't been sent to the device: %v", dps)
+	}
+	if value, _ := device.GetDP("2"); value.String() != "24.5" {
+		t.Errorf("the set value has been cached as %s", value)
+	}
+	if err := device.Set(map[string]interface{}{"3": 20}); !errors.Is(err, tuya.ErrReadOnlyDps) {
+		t.Errorf("setting a read-only dps returned %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package tuya
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/Binozo/GoTuya/internal/commands"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"net"
+)
+
+// negotiateSessionKey performs the session key handshake required since protocol 3.4 and returns the session key.
+// Only the encryption of the frames and the derivation of the session key differ in protocol 3.5.
+// Information has been taken from: https://github.com/jasonacox/tinytuya/blob/master/tinytuya/core/XenonDevice.py
+func (d *Device) negotiateSessionKey(ctx context.Context, connection net.Conn, reader *parser.FrameReader) ([]byte, error) {
+	// The read loop isn't running yet, so the context has to be bound to the whole connection
+	release := bindDeadline(ctx, connection.SetDeadline)
+	defer release()
+	sessionKey, err := d.exchangeSessionKey(ctx, connection, reader)
+	return sessionKey, contextError(ctx, err)
+}
+
+// exchangeSessionKey exchanges the nonces with the Device and derives the session key
+func (d *Device) exchangeSessionKey(ctx context.Context, connection net.Conn, reader *parser.FrameReader) ([]byte, error) {
+	localNonce, err := generateNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Send our nonce
+	if err = d.writeFrame(ctx, connection, d.Key, parser.Message{
+		SequenceNr: d.nextSequenceNr(),
+		Command:    commands.SESS_KEY_NEG_START,
+		Payload:    localNonce,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Step 2: The device answers with its own nonce and proves that it knows the local key
+	negResponse, err := d.readFrame(reader, d.Key)
+	if err != nil {
+		return nil, err
+	}
+	if negResponse.Command != commands.SESS_KEY_NEG_RESP {
+		return nil, &UnexpectedCommandError{Expected: int(commands.SESS_KEY_NEG_RESP), Received: int(negResponse.Command)}
+	}
+	if len(negResponse.Payload) < parser.NonceSize+parser.HmacSize {
+		return nil, fmt.Errorf("%w: session key negotiation answer is too short. Length: %d", ErrMalformedFrame, len(negResponse.Payload))
+	}
+	remoteNonce := negResponse.Payload[:parser.NonceSize]
+	remoteHmac := negResponse.Payload[parser.NonceSize : parser.NonceSize+parser.HmacSize]
+	if !hmac.Equal(remoteHmac, parser.CalculateHmac(localNonce, d.Key)) {
+		return nil, ErrWrongKey
+	}
+
+	// Step 3: Prove that we know the local key too
+	if err = d.writeFrame(ctx, connection, d.Key, parser.Message{
+		SequenceNr: d.nextSequenceNr(),
+		Command:    commands.SESS_KEY_NEG_FINISH,
+		Payload:    parser.CalculateHmac(remoteNonce, d.Key),
+	}); err != nil {
+		return nil, err
+	}
+
+	sessionKey, err := parser.DeriveSessionKey(string(d.ProtocolVersion()), localNonce, remoteNonce, d.Key)
+	if err != nil {
+		return nil, err
+	}
+	d.logger().Debug("negotiated session key")
+	return sessionKey, nil
+}
+
+// generateNonce returns a random printable nonce
+func generateNonce() ([]byte, error) {
+	random := make([]byte, parser.NonceSize/2)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(random)), nil
+}
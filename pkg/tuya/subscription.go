@@ -0,0 +1,84 @@
+package tuya
+
+import "time"
+
+// subscriptionBufferSize of status updates per subscriber
+const subscriptionBufferSize = 16
+
+// StatusUpdate is pushed by the Device whenever dps values change,
+// e.g. if somebody uses the remote of an A/C
+type StatusUpdate struct {
+	// Dps contains only the changed values
+	Dps map[string]interface{}
+	// Time of the change as reported by the Device
+	Time time.Time
+	// schema of the Device decoding the typed values
+	schema Schema
+}
+
+// DPs returns the changed values typed like GetCurrentDPs
+func (u StatusUpdate) DPs() map[string]DPValue {
+	return u.schema.decode(u.Dps)
+}
+
+// Subscribe to the status updates pushed by the Device while connected.
+// Updates are dropped if the channel isn't read fast enough.
+// Call the returned function to cancel the subscription, which closes the channel
+func (d *Device) Subscribe() (<-chan StatusUpdate, func()) {
+	updates := make(chan StatusUpdate, subscriptionBufferSize)
+
+	d.statusMutex.Lock()
+	if d.subscribers == nil {
+		d.subscribers = map[chan StatusUpdate]struct{}{}
+	}
+	d.subscribers[updates] = struct{}{}
+	d.statusMutex.Unlock()
+
+	cancel := func() {
+		d.statusMutex.Lock()
+		defer d.statusMutex.Unlock()
+		if _, ok := d.subscribers[updates]; ok {
+			delete(d.subscribers, updates)
+			close(updates)
+		}
+	}
+	return updates, cancel
+}
+
+// publishStatus merges the pushed dps into the cached status and notifies the subscribers
+func (d *Device) publishStatus(update response) {
+	if len(update.dps) == 0 {
+		return
+	}
+
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+
+	if d.currentStatus.dps == nil {
+		d.currentStatus.dps = map[string]interface{}{}
+	}
+	for key, value := range update.dps {
+		d.currentStatus.dps[key] = value
+	}
+	d.currentStatus.t = update.t
+
+	for subscriber := range d.subscribers {
+		// Every subscriber gets its own copy
+		select {
+		case subscriber <- StatusUpdate{Dps: copyDps(update.dps), Time: update.t, schema: d.Schema}:
+		default:
+			// The subscriber is too slow
+		}
+	}
+}
+
+func copyDps(dps map[string]interface{}) map[string]interface{} {
+	if dps == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(dps))
+	for key, value := range dps {
+		copied[key] = value
+	}
+	return copied
+}
@@ -6,3 +6,38 @@ const Version_3_1 Version = "3.1"
 const Version_3_2 Version = "3.2"
 const Version_3_3 Version = "3.3"
 const Version_3_4 Version = "3.4"
+const Version_3_5 Version = "3.5"
+
+// Version_Auto detects the version when connecting.
+// The announced version is tried first if the Device has been discovered, otherwise the versions are probed.
+// The detected version is remembered and detected again once the Device stops understanding it
+const Version_Auto Version = "auto"
+
+// ProtocolVersion returns the Version the Device is spoken to with.
+// Devices created with Version_Auto return Version_Auto until their version has been detected
+func (d *Device) ProtocolVersion() Version {
+	d.versionMutex.Lock()
+	defer d.versionMutex.Unlock()
+	return d.Version
+}
+
+// setVersion changes the Version the Device is spoken to with
+func (d *Device) setVersion(version Version) {
+	d.versionMutex.Lock()
+	defer d.versionMutex.Unlock()
+	d.Version = version
+}
+
+// isKnown returns if the version is one of the supported tuya api specifications
+func (v Version) isKnown() bool {
+	switch v {
+	case Version_3_1, Version_3_2, Version_3_3, Version_3_4, Version_3_5:
+		return true
+	}
+	return false
+}
+
+// negotiatesSessionKey returns if the version requires a session key and the newer commands introduced with 3.4
+func (v Version) negotiatesSessionKey() bool {
+	return v == Version_3_4 || v == Version_3_5
+}
@@ -0,0 +1,269 @@
+package tuyatest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Binozo/GoTuya/internal/commands"
+	"github.com/Binozo/GoTuya/internal/parser"
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"net"
+	"sync"
+	"time"
+)
+
+// device22IdLength of the ids of devices rejecting DP_QUERY
+const device22IdLength = 22
+
+var errHandshake = errors.New("the client failed to authenticate")
+
+// errWrongVersion is returned if the client speaks another version than the Server
+var errWrongVersion = errors.New("the client speaks another version")
+
+// conn is a single client connected to the Server
+type conn struct {
+	server     *Server
+	connection net.Conn
+	reader     *parser.FrameReader
+	// mutex guards the key and the negotiated flag and serializes writing to the connection
+	mutex sync.Mutex
+	// key is replaced by the session key after the negotiation
+	key         []byte
+	localNonce  []byte
+	remoteNonce []byte
+	// negotiated is set once the client finished the session key negotiation
+	negotiated bool
+}
+
+func newConn(s *Server, connection net.Conn) *conn {
+	return &conn{
+		server:     s,
+		connection: connection,
+		reader:     parser.NewFrameReader(connection),
+		key:        []byte(s.Key),
+	}
+}
+
+func (c *conn) Close() error {
+	return c.connection.Close()
+}
+
+// serve answers the frames of the client until the connection is closed
+func (c *conn) serve() {
+	defer c.Close()
+	for {
+		frame, err := c.reader.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		c.mutex.Lock()
+		key := c.key
+		c.mutex.Unlock()
+		msg, err := parser.DecodeMessage(frame, string(c.server.Version), key, false)
+		if err != nil {
+			// A real device drops clients sending garbage
+			return
+		}
+
+		fault := c.server.nextFault(msg.Command)
+		if fault.Drop {
+			return
+		}
+		time.Sleep(fault.Delay)
+		if fault.Ignore {
+			continue
+		}
+		if err = c.handle(msg, fault); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a single frame of the client. The fault is applied to the answer
+func (c *conn) handle(msg parser.Message, fault Fault) error {
+	// Like a real device, clients speaking another version are dropped
+	negotiating := msg.Command == commands.SESS_KEY_NEG_START || msg.Command == commands.SESS_KEY_NEG_FINISH
+	if negotiating != (c.negotiatesSessionKey() && !c.negotiated) {
+		return errWrongVersion
+	}
+
+	switch msg.Command {
+	case commands.SESS_KEY_NEG_START:
+		remoteNonce, err := randomNonce()
+		if err != nil {
+			return err
+		}
+		c.localNonce = msg.Payload
+		c.remoteNonce = remoteNonce
+		return c.send(fault, msg.SequenceNr, commands.SESS_KEY_NEG_RESP, append(append([]byte{}, c.remoteNonce...), parser.CalculateHmac(c.localNonce, []byte(c.server.Key))...))
+	case commands.SESS_KEY_NEG_FINISH:
+		if !bytes.Equal(msg.Payload, parser.CalculateHmac(c.remoteNonce, []byte(c.server.Key))) {
+			return errHandshake
+		}
+		sessionKey, err := parser.DeriveSessionKey(string(c.server.Version), c.localNonce, c.remoteNonce, []byte(c.server.Key))
+		if err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		c.key = sessionKey
+		c.negotiated = true
+		c.mutex.Unlock()
+		return nil
+	case commands.HEART_BEAT:
+		return c.send(fault, msg.SequenceNr, commands.HEART_BEAT, nil)
+	case commands.DP_QUERY, commands.DP_QUERY_NEW:
+		if msg.Command == commands.DP_QUERY && len(c.server.DeviceID) == device22IdLength {
+			return c.send(fault, msg.SequenceNr, msg.Command, []byte("json obj data unvalid"))
+		}
+		return c.sendDps(fault, msg.SequenceNr, msg.Command, c.server.get(nil))
+	case commands.CONTROL, commands.CONTROL_NEW:
+		dps, err := requestedDps(msg.Payload)
+		if err != nil {
+			return err
+		}
+		if isQuery(dps) {
+			// DeviceType_22 devices are queried by listing the dps with null values
+			keys := make([]string, 0, len(dps))
+			for key := range dps {
+				keys = append(keys, key)
+			}
+			return c.sendDps(fault, msg.SequenceNr, msg.Command, c.server.get(keys))
+		}
+
+		// The dps are applied before the acknowledgement, so they have been applied once the client's request returns
+		c.server.apply(dps)
+		if err = c.send(fault, msg.SequenceNr, msg.Command, nil); err != nil {
+			return err
+		}
+		c.server.push(dps)
+		return nil
+	default:
+		// DP_REFRESH and unknown commands aren't answered
+		return nil
+	}
+}
+
+// negotiatesSessionKey returns if the Server speaks a version requiring a session key
+func (c *conn) negotiatesSessionKey() bool {
+	return c.server.Version == tuya.Version_3_4 || c.server.Version == tuya.Version_3_5
+}
+
+// pushStatus sends the changed dps to the client.
+// Like a real device, nothing is pushed before the client finished the session key negotiation
+func (c *conn) pushStatus(dps map[string]interface{}) {
+	c.mutex.Lock()
+	ready := c.negotiated || !c.negotiatesSessionKey()
+	c.mutex.Unlock()
+	if !ready {
+		return
+	}
+	c.sendDps(Fault{}, 0, commands.STATUS, dps)
+}
+
+// sendDps sends the dps in the json structure matching the Version
+func (c *conn) sendDps(fault Fault, sequenceNr uint32, command commands.Type, dps map[string]interface{}) error {
+	rawJson := map[string]interface{}{
+		"t": time.Now().Unix(),
+	}
+	if c.negotiatesSessionKey() {
+		rawJson["protocol"] = 4
+		rawJson["data"] = map[string]interface{}{
+			"dps": dps,
+		}
+	} else {
+		rawJson["devId"] = c.server.DeviceID
+		rawJson["dps"] = dps
+	}
+
+	jsonBuffer, err := json.Marshal(rawJson)
+	if err != nil {
+		return err
+	}
+	return c.send(fault, sequenceNr, command, jsonBuffer)
+}
+
+// send encodes and writes a frame like a real device including the return code
+func (c *conn) send(fault Fault, sequenceNr uint32, command commands.Type, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if fault.AnswerCommand != 0 {
+		command = fault.AnswerCommand
+	}
+	key := c.key
+	if fault.WrongKey {
+		key = wrongKey(key)
+		if len(payload) == 0 {
+			payload = wrongKeyPayload
+		}
+	}
+	encoded, err := parser.EncodeMessage(parser.Message{
+		SequenceNr:    sequenceNr,
+		Command:       command,
+		HasReturnCode: true,
+		Payload:       payload,
+	}, string(c.server.Version), key)
+	if err != nil {
+		return err
+	}
+	if fault.CorruptChecksum {
+		// The checksum is followed by the 4 bytes of the suffix
+		encoded[len(encoded)-5] ^= 0xFF
+	}
+
+	if fault.Split <= 0 {
+		_, err = c.connection.Write(encoded)
+		return err
+	}
+	for len(encoded) > 0 {
+		part := encoded[:min(fault.Split, len(encoded))]
+		if _, err = c.connection.Write(part); err != nil {
+			return err
+		}
+		encoded = encoded[len(part):]
+		time.Sleep(splitPause)
+	}
+	return nil
+}
+
+// requestedDps returns the dps of a CONTROL or CONTROL_NEW payload
+func requestedDps(payload []byte) (map[string]interface{}, error) {
+	var jsonRequest struct {
+		Dps  map[string]interface{} `json:"dps"`
+		Data struct {
+			Dps map[string]interface{} `json:"dps"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &jsonRequest); err != nil {
+		return nil, err
+	}
+	if jsonRequest.Dps != nil {
+		return jsonRequest.Dps, nil
+	}
+	return jsonRequest.Data.Dps, nil
+}
+
+// isQuery returns if every requested dps is null
+func isQuery(dps map[string]interface{}) bool {
+	if len(dps) == 0 {
+		return false
+	}
+	for _, value := range dps {
+		if value != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// randomNonce returns a random printable nonce
+func randomNonce() ([]byte, error) {
+	random := make([]byte, parser.NonceSize/2)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(random)), nil
+}
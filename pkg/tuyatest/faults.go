@@ -0,0 +1,101 @@
+package tuyatest
+
+import (
+	"github.com/Binozo/GoTuya/internal/commands"
+	"time"
+)
+
+// Command of a frame sent to the fake device
+type Command = commands.Type
+
+// Commands faults can be injected for
+const (
+	SessionKeyStart Command = commands.SESS_KEY_NEG_START
+	Control         Command = commands.CONTROL
+	Status          Command = commands.STATUS
+	Heartbeat       Command = commands.HEART_BEAT
+	Query           Command = commands.DP_QUERY
+	ControlNew      Command = commands.CONTROL_NEW
+	QueryNew        Command = commands.DP_QUERY_NEW
+)
+
+// splitPause between the parts of a split frame, so they are sent as separate tcp segments
+const splitPause = 5 * time.Millisecond
+
+// Fault changes how the fake device reacts to a frame sent by a client
+type Fault struct {
+	// Command of the received frame the fault applies to. Applies to any frame if 0
+	Command Command
+	// Times the fault is applied. 0 applies it once, a negative value applies it forever
+	Times int
+	// Drop closes the connection instead of answering
+	Drop bool
+	// Ignore doesn't answer at all
+	Ignore bool
+	// Delay before answering
+	Delay time.Duration
+	// Split sends the answer in parts of the given size
+	Split int
+	// CorruptChecksum breaks the crc, the hmac or the authentication tag of the answer
+	CorruptChecksum bool
+	// AnswerCommand replaces the command of the answer
+	AnswerCommand Command
+	// WrongKey encrypts the answer with another key.
+	// Answers without data, like the acknowledgement of a CONTROL, carry an encrypted json object instead,
+	// because protocol 3.1 and 3.3 only secure empty answers with a crc
+	WrongKey bool
+}
+
+// wrongKeyPayload is sent instead of an empty answer if the answer is encrypted with a wrong key
+var wrongKeyPayload = []byte("{}")
+
+// Inject queues faults. Every received frame consumes the first queued fault matching its command
+func (s *Server) Inject(faults ...Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// ClearFaults removes every queued fault
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// DropConnections closes the connection of every client like a rebooting device
+func (s *Server) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// nextFault consumes the first queued fault matching the command
+func (s *Server) nextFault(command Command) Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, fault := range s.faults {
+		if fault.Command != 0 && fault.Command != command {
+			continue
+		}
+		switch {
+		case fault.Times > 1:
+			s.faults[i].Times--
+		case fault.Times >= 0:
+			s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+		}
+		return fault
+	}
+	return Fault{}
+}
+
+// wrongKey returns another key of the same length
+func wrongKey(key []byte) []byte {
+	wrong := make([]byte, len(key))
+	for i := range key {
+		wrong[i] = ^key[i]
+	}
+	return wrong
+}
@@ -0,0 +1,102 @@
+package tuyatest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// controlCommand returns the command the Device sets dps with
+func controlCommand(version tuya.Version) tuyatest.Command {
+	if version == tuya.Version_3_4 || version == tuya.Version_3_5 {
+		return tuyatest.ControlNew
+	}
+	return tuyatest.Control
+}
+
+// integrityError returns the error of a frame whose crc, hmac or authentication tag is broken
+func integrityError(version tuya.Version) error {
+	switch version {
+	case tuya.Version_3_4:
+		return tuya.ErrHmacMismatch
+	case tuya.Version_3_5:
+		return tuya.ErrDecryptionFailed
+	}
+	return tuya.ErrCrcMismatch
+}
+
+func TestFaults(t *testing.T) {
+	for _, version := range tuyatest.Versions {
+		tests := []struct {
+			name  string
+			fault tuyatest.Fault
+			// dropConnections while the Device waits for the answer
+			dropConnections bool
+			// want is the error returned by Set. An UnexpectedCommandError is expected if the answer command is replaced
+			want error
+		}{
+			{"drop", tuyatest.Fault{Drop: true}, false, tuya.ErrConnectionClosed},
+			{"delay", tuyatest.Fault{Delay: 300 * time.Millisecond}, false, tuya.ErrTimeout},
+			{"split", tuyatest.Fault{Split: 7}, false, nil},
+			{"corrupt checksum", tuyatest.Fault{CorruptChecksum: true}, false, integrityError(version)},
+			{"answer command", tuyatest.Fault{AnswerCommand: tuyatest.Heartbeat}, false, nil},
+			{"drop connections", tuyatest.Fault{Ignore: true}, true, tuya.ErrConnectionClosed},
+		}
+		for _, test := range tests {
+			t.Run(string(version)+"/"+test.name, func(t *testing.T) {
+				server := tuyatest.StartServer(t, tuyatest.DeviceID, version, testDps)
+				device := server.Connect(t)
+				fault := test.fault
+				fault.Command = controlCommand(version)
+				server.Inject(fault)
+				if test.dropConnections {
+					time.AfterFunc(50*time.Millisecond, server.DropConnections)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+				defer cancel()
+				err := device.SetContext(ctx, map[string]interface{}{"1": true})
+				var commandErr *tuya.UnexpectedCommandError
+				switch {
+				case test.fault.AnswerCommand != 0:
+					if !errors.As(err, &commandErr) {
+						t.Errorf("expected an UnexpectedCommandError, got %v", err)
+					}
+				case test.want == nil:
+					if err != nil {
+						t.Errorf("setting failed: %v", err)
+					}
+				case !errors.Is(err, test.want):
+					t.Errorf("expected %v, got %v", test.want, err)
+				}
+			})
+		}
+	}
+}
+
+func TestFaultWrongKey(t *testing.T) {
+	for _, version := range tuyatest.Versions {
+		t.Run(string(version), func(t *testing.T) {
+			server := tuyatest.StartServer(t, tuyatest.DeviceID, version, testDps)
+			if version == tuya.Version_3_4 || version == tuya.Version_3_5 {
+				// The key is proven by the session key negotiation
+				server.Inject(tuyatest.Fault{Command: tuyatest.SessionKeyStart, WrongKey: true})
+				if err := server.Device().Connect(); !errors.Is(err, tuya.ErrWrongKey) {
+					t.Errorf("expected ErrWrongKey, got %v", err)
+				}
+				return
+			}
+
+			device := server.Connect(t)
+			// The acknowledgement of a CONTROL doesn't carry any data
+			server.Inject(tuyatest.Fault{Command: tuyatest.Control, WrongKey: true})
+			if err := device.Set(map[string]interface{}{"1": true}); !errors.Is(err, tuya.ErrWrongKey) {
+				t.Errorf("expected ErrWrongKey, got %v", err)
+			}
+		})
+	}
+}
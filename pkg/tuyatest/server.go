@@ -0,0 +1,171 @@
+// Package tuyatest provides a fake tuya device to test code using the tuya package without real hardware
+package tuyatest
+
+import (
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"net"
+	"sync"
+)
+
+// Server is a fake tuya device listening on a local tcp port.
+// It speaks the protocol of its Version, drops clients speaking another one, answers queries and commands from its dps
+// and pushes every change to the connected clients like a real device
+type Server struct {
+	// DeviceID of the fake device.
+	// Devices with a 22 characters long id behave like DeviceType_22 devices and reject DP_QUERY
+	DeviceID string
+	// Key the traffic is encrypted with
+	Key string
+	// Version of the tuya api the fake device speaks
+	Version tuya.Version
+	// listener accepts the connections of the clients
+	listener net.Listener
+	// mutex guards the dps, the connections and the faults
+	mutex sync.Mutex
+	dps   map[string]interface{}
+	conns map[*conn]struct{}
+	// faults queued by Inject
+	faults []Fault
+	// closed is set once Close has been called
+	closed bool
+	// wg waits for all goroutines when closing
+	wg sync.WaitGroup
+}
+
+// CreateServer starts a fake device listening on a random port of 127.0.0.1
+func CreateServer(deviceId string, key string, version tuya.Version, dps map[string]interface{}) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		DeviceID: deviceId,
+		Key:      key,
+		Version:  version,
+		listener: listener,
+		dps:      copyDps(dps),
+		conns:    map[*conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Addr returns the address the fake device listens on
+func (s *Server) Addr() *net.TCPAddr {
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
+// Device returns a tuya.Device connecting to the fake device
+func (s *Server) Device() *tuya.Device {
+	device := tuya.CreateDevice(s.Addr().IP.String(), s.DeviceID, s.Key, s.Version)
+	device.Port = s.Addr().Port
+	return device
+}
+
+// Dps returns a copy of the current dps of the fake device
+func (s *Server) Dps() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyDps(s.dps)
+}
+
+// Update changes the dps like somebody using the remote and pushes the change to every connected client
+func (s *Server) Update(dps map[string]interface{}) {
+	s.apply(dps)
+	s.push(dps)
+}
+
+// apply changes the dps without pushing them
+func (s *Server) apply(dps map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, value := range dps {
+		s.dps[key] = value
+	}
+}
+
+// push the changed dps to every connected client
+func (s *Server) push(dps map[string]interface{}) {
+	s.mutex.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mutex.Unlock()
+
+	for _, c := range conns {
+		c.pushStatus(dps)
+	}
+}
+
+// Close stops listening and drops every connection
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mutex.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// acceptLoop serves every client until the listener is closed
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		connection, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := newConn(s, connection)
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			connection.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+
+			s.mutex.Lock()
+			delete(s.conns, c)
+			s.mutex.Unlock()
+		}()
+	}
+}
+
+// get returns the requested dps or all dps if keys is nil
+func (s *Server) get(keys []string) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if keys == nil {
+		return copyDps(s.dps)
+	}
+	dps := map[string]interface{}{}
+	for _, key := range keys {
+		if value, ok := s.dps[key]; ok {
+			dps[key] = value
+		}
+	}
+	return dps
+}
+
+func copyDps(dps map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(dps))
+	for key, value := range dps {
+		copied[key] = value
+	}
+	return copied
+}
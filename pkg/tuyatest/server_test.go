@@ -0,0 +1,107 @@
+package tuyatest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+	"github.com/Binozo/GoTuya/pkg/tuyatest"
+)
+
+// testDps of the fake devices
+var testDps = map[string]interface{}{
+	"1":   false,
+	"2":   20,
+	"4":   "cold",
+	"101": true,
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		deviceId   string
+		deviceType tuya.DeviceType
+	}{
+		{"default", tuyatest.DeviceID, tuya.DeviceType_Default},
+		{"device22", tuyatest.Device22ID, tuya.DeviceType_22},
+	}
+	for _, version := range tuyatest.Versions {
+		for _, test := range tests {
+			t.Run(string(version)+"/"+test.name, func(t *testing.T) {
+				server := tuyatest.StartServer(t, test.deviceId, version, testDps)
+				device := server.Connect(t)
+
+				t.Run("connect", func(t *testing.T) {
+					if device.DeviceType != test.deviceType {
+						t.Errorf("expected the device type %s, got %s", test.deviceType, device.DeviceType)
+					}
+					status := device.GetCurrentStatus()
+					for _, index := range []string{"1", "2", "4", "101"} {
+						if _, ok := status[index]; !ok {
+							t.Errorf("dps %s hasn't been fetched when connecting: %v", index, status)
+						}
+					}
+				})
+
+				t.Run("set", func(t *testing.T) {
+					if err := device.Set(map[string]interface{}{"1": true, "2": 24}); err != nil {
+						t.Fatalf("setting failed: %v", err)
+					}
+					dps := server.Dps()
+					if dps["1"] != true || dps["2"] != float64(24) {
+						t.Errorf("the fake device didn't apply the dps: %v", dps)
+					}
+				})
+
+				t.Run("fetch status", func(t *testing.T) {
+					server.Update(map[string]interface{}{"4": "heat"})
+					dps, err := device.FetchStatus()
+					if err != nil {
+						t.Fatalf("fetching the status failed: %v", err)
+					}
+					if dps["4"] != "heat" {
+						t.Errorf("expected dps 4 to be heat, got %v", dps)
+					}
+				})
+
+				t.Run("status push", func(t *testing.T) {
+					updates, cancel := device.Subscribe()
+					defer cancel()
+					server.Update(map[string]interface{}{"2": 18})
+
+					select {
+					case update := <-updates:
+						if update.Dps["2"] != float64(18) {
+							t.Errorf("expected dps 2 to be 18, got %v", update.Dps)
+						}
+					case <-time.After(2 * time.Second):
+						t.Fatal("the status update hasn't been pushed")
+					}
+					if value, err := device.GetDP("2"); err != nil {
+						t.Errorf("reading the pushed dps failed: %v", err)
+					} else if number, _ := value.Int(); number != 18 {
+						t.Errorf("the pushed dps hasn't been cached: %s", value)
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestServerDetectsVersion(t *testing.T) {
+	for _, version := range tuyatest.Versions {
+		t.Run(string(version), func(t *testing.T) {
+			server := tuyatest.StartServer(t, tuyatest.DeviceID, version, testDps)
+			device := server.Device()
+			device.Version = tuya.Version_Auto
+			if err := device.Connect(); err != nil {
+				t.Fatalf("connecting failed: %v", err)
+			}
+			defer device.Disconnect()
+
+			if device.ProtocolVersion() != version {
+				t.Errorf("expected the version %s to be detected, got %s", version, device.ProtocolVersion())
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package tuyatest
+
+import (
+	"testing"
+
+	"github.com/Binozo/GoTuya/pkg/tuya"
+)
+
+// Fixtures of the fake devices started by StartServer
+const (
+	// Key the traffic is encrypted with
+	Key = "0123456789abcdef"
+	// DeviceID of a fake device answering DP_QUERY
+	DeviceID = "15580880bcaac262j6eg"
+	// Device22ID of a fake device rejecting DP_QUERY like a DeviceType_22 device
+	Device22ID = "bf4b2e7a8d0c5a1f3e9x2k"
+)
+
+// Versions the fake device speaks
+var Versions = []tuya.Version{tuya.Version_3_1, tuya.Version_3_3, tuya.Version_3_4, tuya.Version_3_5}
+
+// StartServer starts a fake device using the Key for the test. It is closed when the test ends
+func StartServer(tb testing.TB, deviceId string, version tuya.Version, dps map[string]interface{}) *Server {
+	tb.Helper()
+	server, err := CreateServer(deviceId, Key, version, dps)
+	if err != nil {
+		tb.Fatalf("starting the fake device failed: %v", err)
+	}
+	tb.Cleanup(func() { server.Close() })
+	return server
+}
+
+// Connect returns a Device connected to the fake device. It is disconnected when the test ends
+func (s *Server) Connect(tb testing.TB) *tuya.Device {
+	tb.Helper()
+	device := s.Device()
+	if err := device.Connect(); err != nil {
+		tb.Fatalf("connecting to the fake device failed: %v", err)
+	}
+	tb.Cleanup(device.Disconnect)
+	return device
+}